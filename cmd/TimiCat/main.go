@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"log"
 	"time"
+	_ "time/tzdata" // 内置时区数据库，容器里没有 /usr/share/zoneinfo 也能按用户时区统计
 
 	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
 	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/middleware"
@@ -13,7 +15,10 @@ import (
 )
 
 func main() {
-	cfg, _ := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("config error:", err)
+	}
 	gin.SetMode(gin.ReleaseMode)
 
 	// 初始化数据库连接并运行迁移（AutoMigrate 会自动创建表及索引）
@@ -33,29 +38,113 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok", "ts": time.Now().Unix()})
 	})
 
-	// 游客登录相关
-	r.POST("/guest-login", handlers.GuestLogin(cfg))
-	r.GET("/me", handlers.Me())
+	// 游客登录与刷新 token（签发 token，不需要鉴权）
+	acc := handlers.NewAccount(gormDB, cfg)
+	r.POST("/guest-login", acc.GuestLogin)
+	r.POST("/api/v1/auth/refresh", acc.Refresh) // body: {"refresh_token":"..."}，轮换出一对新 token
+
+	// 注册账号：邮箱 + 密码，token 同时携带 vid 与 uid
+	// 游客 token 过期或已注销也能注册/登录，只是没有游客数据可合并
+	optional := middleware.OptionalAuth(cfg, gormDB)
+	r.POST("/api/v1/auth/register", optional, acc.Register)
+	r.POST("/api/v1/auth/login", optional, acc.Login)
+
+	// 以下路由都需要识别身份：优先 Bearer token，兼容模式下退回 tcid cookie
+	auth := middleware.Auth(cfg, gormDB)
+	r.GET("/me", auth, handlers.Me())
+
+	api := r.Group("/api/v1", auth)
+
+	api.POST("/auth/logout", acc.Logout)
+	api.POST("/auth/logout-all", acc.LogoutAll)            // 注销所有设备上的登录
+	api.GET("/auth/tokens", acc.Tokens)                    // 列出仍然有效的登录
+	api.DELETE("/auth/tokens/:family_id", acc.RevokeToken) // 注销某一个设备
 
 	// 番茄钟计时及统计相关路由
-	f := handlers.NewFocus(gormDB)
+	f := handlers.NewFocus(gormDB, cfg)
+	if n, err := f.EnsureRollups(); err != nil {
+		log.Fatal("rebuild daily stats error:", err)
+	} else if n > 0 {
+		log.Printf("rebuilt daily stats for %d owners", n)
+	}
+	if err := f.SeedAchievements(cfg.AchievementsFile); err != nil {
+		log.Fatal("seed achievements error:", err)
+	}
+	// 后台调度器：倒计时到点自动结束、番茄钟阶段自动切换（客户端离线也会进行）、心跳超时自动暂停、遗弃会话收口
+	go f.RunScheduler(context.Background(), cfg.SchedulerInterval)
 
-	r.POST("/api/v1/sessions/start", f.Start)    // 开始新的计时
-	r.POST("/api/v1/sessions/pause", f.Pause)    // 暂停计时
-	r.POST("/api/v1/sessions/resume", f.Resume)  // 恢复计时
-	r.POST("/api/v1/sessions/finish", f.Finish)  // 完成计时
-	r.POST("/api/v1/sessions/cancel", f.Cancel)  // 取消计时
-	r.GET("/api/v1/sessions/current", f.Current) // 查询当前计时
+	// 会话写接口与成长事件确认支持 Idempotency-Key 请求头，弱网重试不会重复执行
+	idem := middleware.Idempotency(gormDB, cfg.IdempotencyTTL)
+
+	api.POST("/sessions/start", idem, f.Start)          // 开始新的计时
+	api.POST("/sessions/pause", idem, f.Pause)          // 暂停计时，body 可选：{"reason":"internal|external|break","note":"..."}
+	api.POST("/sessions/resume", idem, f.Resume)        // 恢复计时
+	api.POST("/sessions/finish", idem, f.Finish)        // 完成计时
+	api.POST("/sessions/cancel", idem, f.Cancel)        // 取消计时
+	api.GET("/sessions/current", f.Current)             // 查询当前计时
+	api.GET("/sessions", f.ListSessions)                // 历史会话，游标分页 + 过滤/排序
+	api.GET("/sessions/:id", f.GetSession)              // 会话详情与片段时间线
+	api.POST("/sessions/heartbeat", f.Heartbeat)        // 计时期间定时心跳，超时未收到会被自动暂停
+	api.POST("/sessions/sync", idem, f.SyncSessions)    // 批量上传离线期间记录的生命周期事件，返回对账后的会话
+	api.POST("/sessions/manual", idem, f.ManualSession) // 补录离线专注，body: {"start_at":"...","end_at":"..."}
+	api.PATCH("/sessions/:id", f.EditSession)           // 修改已完成的会话（时间/任务/标签）
+	api.DELETE("/sessions/:id", f.DeleteSession)        // 删除会话，已计入的分钟数冲回
+
+	// 番茄钟：工作/短休息/长休息自动切换，工作阶段就是一条 pomodoro 模式的会话（可用上面的接口暂停/继续）
+	api.POST("/pomodoro/start", f.PomodoroStart)    // 开始一整轮番茄钟
+	api.GET("/pomodoro/current", f.PomodoroCurrent) // 当前阶段与剩余秒数
+	api.POST("/pomodoro/skip", f.PomodoroSkip)      // 跳过休息 / 提前结束本轮工作
+	api.POST("/pomodoro/stop", f.PomodoroStop)      // 结束整轮番茄钟
+
+	// 任务：开始专注时可传 task_id，任务的专注时长与番茄数由会话片段统计
+	api.GET("/tasks", f.ListTasks)
+	api.POST("/tasks", f.CreateTask)
+	api.POST("/tasks/reorder", f.ReorderTasks) // body: {"ids":[3,1,2]}
+	api.GET("/tasks/:id", f.GetTask)
+	api.PATCH("/tasks/:id", f.UpdateTask)
+	api.DELETE("/tasks/:id", f.DeleteTask)
+
+	// 标签：开始/结束专注时传 tags（标签名），不存在的自动创建
+	api.GET("/tags", f.ListTags)
+	api.POST("/tags", f.CreateTag)
+	api.PATCH("/tags/:id", f.UpdateTag)
+	api.DELETE("/tags/:id", f.DeleteTag)
+
+	// 个人设置：时区（统计按该时区切分日/周/月，单次请求也可用 ?tz= 或 X-Timezone 覆盖）
+	api.GET("/settings", f.GetSettings)
+	api.PUT("/settings", f.UpdateSettings) // body: {"timezone":"Asia/Shanghai"}
+
+	// 目标：每日/每周的分钟数或番茄数，达成时产生 goal_met 成长事件
+	api.GET("/goals", f.ListGoals)
+	api.POST("/goals", f.CreateGoal) // body: {"period":"daily|weekly","metric":"minutes|pomodoros","target":120}
+	api.PATCH("/goals/:id", f.UpdateGoal)
+	api.DELETE("/goals/:id", f.DeleteGoal)
 
 	// 统计相关：今日/近7天/总计
-	r.GET("/api/v1/stats/summary", f.Summary)
+	api.GET("/stats/summary", f.Summary)
+	api.GET("/stats/range", f.RangeStats)                // 分桶统计，?from=&to=&granularity=day|week|month
+	api.GET("/stats/heatmap", f.Heatmap)                 // 全年每日热力图，?year=2025，跨 0 点的会话按片段拆分
+	api.GET("/stats/streaks", f.Streaks)                 // 连续专注天数：当前、最长与历史，?min_minutes= 覆盖每天的达标分钟
+	api.GET("/stats/tags", f.TagStats)                   // 按标签/分类汇总分钟数，?from=2025-01-01&to=2025-01-31
+	api.GET("/stats/interruptions", f.InterruptionStats) // 中断分析：最常见的原因、每专注 1 小时的中断次数
 
 	// 成长事件：用于前端和宠物系统获取用户成长数据
-	r.GET("/api/v1/events/growth/pull", f.GrowthPull) // 拉取未处理的成长事件，?limit=50
-	r.POST("/api/v1/events/growth/ack", f.GrowthAck)  // 确认已处理的成长事件，body: {"last_id":123}
+	api.GET("/events/growth/pull", f.GrowthPull)      // 拉取未处理的成长事件，?limit=50
+	api.POST("/events/growth/ack", idem, f.GrowthAck) // 确认已处理的成长事件，body: {"last_id":123}
+
+	//成就：规则与文案在 achievements 表里，会话结束/任务完成时更新进度
+	api.GET("/achievements", f.Achievements)
 
-	//成就
-	r.GET("/api/v1/achievements", f.Achievements)
+	// 管理接口：成就定义的增改、排序、停用、预览与回滚，X-Admin-Token 鉴权（ADMIN_TOKEN 为空时关闭）
+	admin := r.Group("/api/v1/admin", middleware.Admin(cfg))
+	admin.GET("/achievements", f.AdminListAchievements)
+	admin.POST("/achievements", f.AdminCreateAchievement)                               // ?dry_run=true 只预览不保存
+	admin.POST("/achievements/preview", f.AdminPreviewAchievement)                      // 展示效果 + 现有用户中会解锁的人数
+	admin.POST("/achievements/reorder", f.AdminReorderAchievements)                     // body: {"ids":[3,1,2]}
+	admin.PATCH("/achievements/:id", f.AdminUpdateAchievement)                          // ?dry_run=true 只预览不保存
+	admin.DELETE("/achievements/:id", f.AdminDisableAchievement)                        // 停用，已解锁的记录保留
+	admin.GET("/achievements/versions", f.AdminAchievementVersions)                     // 每次修改都会保存一份快照
+	admin.POST("/achievements/versions/:version/rollback", f.AdminRollbackAchievements) // 恢复到某个版本
 
 	log.Println("listen on", cfg.Addr)
 	if err := r.Run(cfg.Addr); err != nil {
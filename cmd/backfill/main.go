@@ -0,0 +1,27 @@
+// backfill 按现有会话重建每日汇总表 daily_stats
+// 上线每日汇总之前的历史数据、手工改过会话表或修改了 DEFAULT_TIMEZONE 之后运行一次：go run ./cmd/backfill
+package main
+
+import (
+	"log"
+	_ "time/tzdata"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/handlers"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("config error:", err)
+	}
+	db, err := config.Init(cfg)
+	if err != nil {
+		log.Fatal("db init error:", err)
+	}
+	n, err := handlers.NewFocus(db, cfg).RebuildRollups()
+	if err != nil {
+		log.Fatal("backfill error:", err)
+	}
+	log.Printf("rebuilt daily stats for %d owners", n)
+}
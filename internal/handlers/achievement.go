@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// evalCtx 一次成就评估的上下文：同一次评估里多个成就用到的同一个汇总值只查一次
+type evalCtx struct {
+	tx   *gorm.DB
+	o    owner
+	loc  *time.Location
+	memo map[string]int64
+}
+
+// cached 以 key 缓存 fn 的结果
+func (e *evalCtx) cached(key string, fn func() int64) int64 {
+	if v, ok := e.memo[key]; ok {
+		return v
+	}
+	v := fn()
+	e.memo[key] = v
+	return v
+}
+
+// newEvalCtx 按归属者的时区创建评估上下文
+func newEvalCtx(tx *gorm.DB, o owner) (*evalCtx, error) {
+	loc, err := time.LoadLocation(ownerTimezone(tx, o))
+	if err != nil {
+		return nil, err
+	}
+	return &evalCtx{tx: tx, o: o, loc: loc, memo: map[string]int64{}}, nil
+}
+
+// finished 该归属者已完成会话的查询
+func (e *evalCtx) finished() *gorm.DB {
+	return e.tx.Model(&models.Session{}).Scopes(e.o.scope).Where("status='finished'")
+}
+
+// achievementRule 计算归属者在某个成就上的进度，单位与 Threshold 相同
+type achievementRule func(e *evalCtx, a models.Achievement) int64
+
+// achievementRules 规则类型 -> 计算方式；新增规则类型只需在这里注册
+var achievementRules = map[string]achievementRule{
+	models.RuleCumulativeTime: func(e *evalCtx, _ models.Achievement) int64 {
+		return e.cached("seconds", func() (n int64) {
+			e.tx.Model(&models.DailyStat{}).Where("owner_key=?", e.o.key()).
+				Select("COALESCE(SUM(seconds), 0)").Scan(&n)
+			return
+		})
+	},
+	models.RuleSessionCount: func(e *evalCtx, _ models.Achievement) int64 {
+		return e.cached("sessions", func() (n int64) {
+			e.tx.Model(&models.DailyStat{}).Where("owner_key=?", e.o.key()).
+				Select("COALESCE(SUM(sessions), 0)").Scan(&n)
+			return
+		})
+	},
+	models.RuleSessionLength: func(e *evalCtx, _ models.Achievement) int64 {
+		return e.cached("longest", func() (n int64) {
+			e.finished().Select("COALESCE(MAX(duration_sec), 0)").Scan(&n)
+			return
+		})
+	},
+	models.RuleStreak: func(e *evalCtx, a models.Achievement) int64 {
+		minMinutes := max(a.MinMinutes, 1)
+		return e.cached(fmt.Sprintf("streak:%d", minMinutes), func() int64 {
+			return longestStreak(e.tx, e.o, minMinutes)
+		})
+	},
+	models.RuleTimeOfDay: func(e *evalCtx, a models.Achievement) int64 {
+		q := e.finished()
+		hour := "EXTRACT(HOUR FROM start_at AT TIME ZONE ?)"
+		switch {
+		case a.BeforeHour != nil:
+			q = q.Where(hour+" < ?", e.loc.String(), *a.BeforeHour)
+		case a.AfterHour != nil:
+			q = q.Where(hour+" >= ?", e.loc.String(), *a.AfterHour)
+		default:
+			return 0
+		}
+		var n int64
+		q.Count(&n)
+		return n
+	},
+	models.RuleTaskCompletion: func(e *evalCtx, _ models.Achievement) int64 {
+		return e.cached("tasks", func() (n int64) {
+			e.tx.Model(&models.Task{}).Scopes(e.o.scope).Where("status='done'").Count(&n)
+			return
+		})
+	},
+	models.RuleCountdownRate: func(e *evalCtx, a models.Achievement) int64 {
+		hits, runs := e.countdownRuns()
+		return countdownRate(hits, runs, a.MinCount)
+	},
+}
+
+// countdownRuns 倒计时/番茄钟里跑满计划时长的次数与计入完成率的总次数
+func (e *evalCtx) countdownRuns() (hits, runs int64) {
+	runs = e.cached("countdown_runs", func() int64 {
+		var r struct{ Hits, Runs int64 }
+		e.tx.Model(&models.Session{}).Scopes(e.o.scope).
+			Select(`COUNT(*) FILTER (WHERE status='finished' AND duration_sec >= planned_minutes * 60) AS hits,
+				COUNT(*) AS runs`).
+			Where("mode IN ('countdown','pomodoro') AND status IN ('finished','canceled') AND planned_minutes IS NOT NULL").
+			Scan(&r)
+		e.memo["countdown_hits"] = r.Hits
+		return r.Runs
+	})
+	return e.memo["countdown_hits"], runs
+}
+
+// countdownRate 完成率百分比，次数不足 minCount 时为 0
+func countdownRate(hits, runs int64, minCount int) int64 {
+	if runs == 0 || runs < int64(minCount) {
+		return 0
+	}
+	return hits * 100 / runs
+}
+
+// longestStreak 日汇总里每天至少 minMinutes 分钟的最长连续天数
+func longestStreak(db *gorm.DB, o owner, minMinutes int) int64 {
+	var days []time.Time
+	db.Model(&models.DailyStat{}).Where("owner_key=? AND seconds >= ?", o.key(), minMinutes*60).
+		Order("day ASC").Pluck("day", &days)
+	var longest, cur int64
+	for i, d := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(d) {
+			cur++
+		} else {
+			cur = 1
+		}
+		longest = max(longest, cur)
+	}
+	return longest
+}
+
+// loadAchievements 按 sort_order 读取启用中的成就定义
+func loadAchievements(db *gorm.DB) ([]models.Achievement, error) {
+	var defs []models.Achievement
+	err := db.Where("disabled=false").Order("sort_order ASC, id ASC").Find(&defs).Error
+	return defs, err
+}
+
+// visibleAchievements 归属者能看到的成就：启用中的，加上已经解锁过、后来被停用的
+func visibleAchievements(db *gorm.DB, o owner) ([]models.Achievement, error) {
+	var defs []models.Achievement
+	err := db.Where("disabled=false OR id IN (?)",
+		db.Model(&models.UserAchievement{}).Select("achievement_id").Where("owner_key=?", o.key())).
+		Order("sort_order ASC, id ASC").Find(&defs).Error
+	return defs, err
+}
+
+// evaluateAchievements 按全部历史重新计算归属者在 defs 上的进度并保存
+// 只涉及当前归属者，每种汇总值只查一次
+func evaluateAchievements(tx *gorm.DB, o owner, defs []models.Achievement) (map[int]int64, error) {
+	e, err := newEvalCtx(tx, o)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int]int64, len(defs))
+	rows := make([]models.AchievementProgress, 0, len(defs))
+	for _, a := range defs {
+		rule, ok := achievementRules[a.RuleKind()]
+		if !ok {
+			continue
+		}
+		row := models.AchievementProgress{OwnerKey: o.key(), AchievementID: a.ID, Value: rule(e, a)}
+		if a.RuleKind() == models.RuleCountdownRate {
+			row.Hits, row.Runs = e.countdownRuns()
+		}
+		res[a.ID] = row.Value
+		rows = append(rows, row)
+	}
+	return res, saveProgress(tx, rows)
+}
+
+// saveProgress 写入（或覆盖）进度行
+func saveProgress(tx *gorm.DB, rows []models.AchievementProgress) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "owner_key"}, {Name: "achievement_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "hits", "runs", "updated_at"}),
+	}).Create(&rows).Error
+}
+
+// onAchievementEvent 全量重新评估该归属者（修改/删除会话、合并账号之后），达到门槛的成就在同一个事务里解锁
+// kinds 非空时只评估这些规则类型（如任务完成只影响 task_completion）；sessionID 为触发的会话，没有时传 0
+func onAchievementEvent(tx *gorm.DB, o owner, sessionID uint, at time.Time, kinds ...string) error {
+	defs, err := loadAchievements(tx)
+	if err != nil {
+		return err
+	}
+	if len(kinds) > 0 {
+		defs = slices.DeleteFunc(defs, func(a models.Achievement) bool {
+			return !slices.Contains(kinds, a.RuleKind())
+		})
+	}
+	progress, err := evaluateAchievements(tx, o, defs)
+	if err != nil {
+		return err
+	}
+	return unlockAchievements(tx, o, defs, progress, sessionID, at)
+}
+
+// onSessionClosed 会话结束（finished）或取消后增量更新成就进度：
+// 单次最长、时段计数与完成率由这次会话加上保存的进度推出，不扫全部历史；
+// 累计时长、次数、连续天数读刚刷新过的日汇总；还没有进度行的成就（新定义、被管理接口重置的）退回全量评估
+func onSessionClosed(tx *gorm.DB, sess models.Session, total int64, finished bool, at time.Time) error {
+	o := sessionOwner(sess)
+	defs, err := loadAchievements(tx)
+	if err != nil || len(defs) == 0 {
+		return err
+	}
+	var stored []models.AchievementProgress
+	if err := tx.Where("owner_key=?", o.key()).Find(&stored).Error; err != nil {
+		return err
+	}
+	prev := make(map[int]models.AchievementProgress, len(stored))
+	for _, p := range stored {
+		prev[p.AchievementID] = p
+	}
+	e, err := newEvalCtx(tx, o)
+	if err != nil {
+		return err
+	}
+
+	progress := make(map[int]int64, len(defs))
+	var rows []models.AchievementProgress
+	var missing []models.Achievement
+	for _, a := range defs {
+		p, ok := prev[a.ID]
+		if !ok {
+			missing = append(missing, a)
+			continue
+		}
+		switch a.RuleKind() {
+		case models.RuleTaskCompletion:
+			continue // 与会话无关
+		case models.RuleSessionLength:
+			if finished {
+				p.Value = max(p.Value, total)
+			}
+		case models.RuleTimeOfDay:
+			if finished && inHourRange(a, sess.StartAt.In(e.loc).Hour()) {
+				p.Value++
+			}
+		case models.RuleCountdownRate:
+			if (sess.Mode == "countdown" || sess.Mode == "pomodoro") && sess.PlannedMinutes != nil {
+				p.Runs++
+				if finished && total >= int64(*sess.PlannedMinutes)*60 {
+					p.Hits++
+				}
+				p.Value = countdownRate(p.Hits, p.Runs, a.MinCount)
+			}
+		default:
+			rule, ok := achievementRules[a.RuleKind()]
+			if !ok {
+				continue
+			}
+			p.Value = rule(e, a)
+		}
+		progress[a.ID] = p.Value
+		rows = append(rows, p)
+	}
+	if err := saveProgress(tx, rows); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		got, err := evaluateAchievements(tx, o, missing)
+		if err != nil {
+			return err
+		}
+		maps.Copy(progress, got)
+	}
+	return unlockAchievements(tx, o, defs, progress, sess.ID, at)
+}
+
+// inHourRange 当地时间的小时是否满足 time_of_day 成就的时段
+func inHourRange(a models.Achievement, hour int) bool {
+	switch {
+	case a.BeforeHour != nil:
+		return hour < *a.BeforeHour
+	case a.AfterHour != nil:
+		return hour >= *a.AfterHour
+	}
+	return false
+}
+
+// unlockAchievements 把进度达到门槛且尚未解锁的成就记入 user_achievements，并各发一条 achievement_unlocked 成长事件
+// 唯一索引保证并发时也只解锁一次，事件只在真正插入了记录时才发
+func unlockAchievements(tx *gorm.DB, o owner, defs []models.Achievement, progress map[int]int64, sessionID uint, at time.Time) error {
+	var sid *uint
+	if sessionID != 0 {
+		sid = &sessionID
+	}
+	for _, a := range defs {
+		v, ok := progress[a.ID]
+		if !ok || v < a.Threshold {
+			continue
+		}
+		r := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserAchievement{
+			OwnerKey:      o.key(),
+			AchievementID: a.ID,
+			SessionID:     sid,
+			UnlockedAt:    at,
+		})
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			continue // 早已解锁
+		}
+		ref := uint(a.ID)
+		if err := tx.Create(&models.GrowthEvent{
+			VisitorID: o.VisitorID,
+			UserID:    o.UserID,
+			Type:      models.GrowthAchievementUnlocked,
+			SessionID: sessionID,
+			RefID:     &ref,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlockedAchievements 归属者已解锁的成就，成就 ID -> 解锁时间
+func unlockedAchievements(db *gorm.DB, o owner) (map[int]time.Time, error) {
+	var rows []models.UserAchievement
+	if err := db.Where("owner_key=?", o.key()).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[int]time.Time, len(rows))
+	for _, r := range rows {
+		res[r.AchievementID] = r.UnlockedAt
+	}
+	return res, nil
+}
+
+// achievementProgress 读取保存的进度；还没有进度的成就（老数据、新加的定义）当场评估一次，
+// 已经达到门槛的顺带解锁，避免上线前就满足条件的用户拿不到徽章
+func (f *Focus) achievementProgress(o owner, defs []models.Achievement) (map[int]int64, error) {
+	var rows []models.AchievementProgress
+	if err := f.DB.Where("owner_key=?", o.key()).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	res := make(map[int]int64, len(defs))
+	for _, r := range rows {
+		res[r.AchievementID] = r.Value
+	}
+	var missing []models.Achievement
+	for _, a := range defs {
+		if _, ok := res[a.ID]; !ok {
+			missing = append(missing, a)
+		}
+	}
+	if len(missing) == 0 {
+		return res, nil
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		got, err := evaluateAchievements(tx, o, missing)
+		if err != nil {
+			return err
+		}
+		for id, v := range got {
+			res[id] = v
+		}
+		return unlockAchievements(tx, o, missing, got, 0, time.Now())
+	})
+	return res, err
+}
+
+// SeedAchievements 成就表为空时导入定义：优先 path 指定的 JSON/YAML 文件，文件不存在时用内置的 models.Achievements
+// 表里已有定义时以数据库为准，不会覆盖；之后的修改走管理接口
+// 还没有任何版本记录时（版本功能上线前就导入过定义的库）补一个 seed 版本作为回滚的基线
+func (f *Focus) SeedAchievements(path string) error {
+	var n int64
+	if err := f.DB.Model(&models.Achievement{}).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		var versions int64
+		if err := f.DB.Model(&models.AchievementVersion{}).Count(&versions).Error; err != nil || versions > 0 {
+			return err
+		}
+		return snapshotAchievements(f.DB, "seed", nil, "已有定义")
+	}
+	note := path
+	defs, err := readAchievementFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		defs, note = models.Achievements, "内置定义"
+	} else if err != nil {
+		return err
+	}
+	for i := range defs {
+		if defs[i].SortOrder == 0 {
+			defs[i].SortOrder = i + 1
+		}
+		if err := validateAchievement(&defs[i]); err != nil {
+			return fmt.Errorf("成就 %d: %w", defs[i].ID, err)
+		}
+	}
+	return f.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&defs).Error; err != nil {
+			return err
+		}
+		return snapshotAchievements(tx, "seed", nil, note)
+	})
+}
+
+// readAchievementFile 读取成就定义文件，.yaml/.yml 按 YAML 解析，其余按 JSON
+func readAchievementFile(path string) ([]models.Achievement, error) {
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return nil, err
+		}
+	}
+	var defs []models.Achievement
+	if err := json.Unmarshal(b, &defs); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", path, err)
+	}
+	return defs, nil
+}
+
+// achievementView 成就在列表里的展示：定义本身（requirement 等字段不变）加上当前进度
+type achievementView struct {
+	models.Achievement
+	Progress int64   `json:"progress"` // 与 requirement 同单位
+	Target   int64   `json:"target"`   // 即 requirement
+	Percent  float64 `json:"percent"`  // 0~100，已解锁的为 100
+}
+
+// newAchievementView 合成展示用的成就；未解锁的隐藏成就只剩 id、顺序与 hidden 标记，
+// 名称、文案、规则参数、分级和进度都不返回，否则从 kind/after_hour 就能猜出解锁条件
+func newAchievementView(a models.Achievement, progress int64) achievementView {
+	if a.Hidden && !a.Unlocked {
+		return achievementView{Achievement: models.Achievement{
+			ID: a.ID, Name: "？？？", Subtitle: "隐藏成就", SortOrder: a.SortOrder, Hidden: true,
+		}}
+	}
+	v := achievementView{Achievement: a, Progress: progress, Target: a.Threshold}
+	switch {
+	case a.Unlocked || a.Threshold <= 0:
+		v.Percent = 100
+	default:
+		v.Percent = min(float64(progress)*100/float64(a.Threshold), 100)
+	}
+	return v
+}
+
+// Achievements 返回总专注分钟数与全部成就；unlocked 以 user_achievements 的记录为准，
+// 门槛调高后已解锁的仍然保留
+func (f *Focus) Achievements(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	defs, err := visibleAchievements(f.DB, o)
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	// 停用的成就不再评估，只展示已解锁的结果
+	active := make([]models.Achievement, 0, len(defs))
+	for _, a := range defs {
+		if !a.Disabled {
+			active = append(active, a)
+		}
+	}
+	progress, err := f.achievementProgress(o, active)
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	unlocked, err := unlockedAchievements(f.DB, o)
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	resp := make([]achievementView, 0, len(defs))
+	for _, a := range defs {
+		if at, ok := unlocked[a.ID]; ok {
+			a.Unlocked, a.UnlockedAt = true, &at
+		}
+		resp = append(resp, newAchievementView(a, progress[a.ID]))
+	}
+	c.JSON(200, gin.H{
+		"total_minutes": f.totalFocusSeconds(o) / 60, // 方便前端展示
+		"achievements":  resp,
+	})
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
+)
+
+var (
+	errAchievementExists   = errors.New("成就 ID 已存在")
+	errAchievementNotFound = errors.New("成就不存在")
+	errVersionNotFound     = errors.New("版本不存在")
+)
+
+// adminStatus 把管理接口的错误映射成 HTTP 状态码
+func adminStatus(err error) int {
+	var br badRequest
+	switch {
+	case errors.As(err, &br):
+		return 400
+	case errors.Is(err, errAchievementExists):
+		return 409
+	case errors.Is(err, errAchievementNotFound), errors.Is(err, errVersionNotFound):
+		return 404
+	default:
+		return 500
+	}
+}
+
+// validateAchievement 校验成就定义，并把空的规则类型补成 cumulative_time
+func validateAchievement(a *models.Achievement) error {
+	a.Kind = a.RuleKind()
+	if _, ok := achievementRules[a.Kind]; !ok {
+		return badRequest("规则类型 " + strconv.Quote(a.Kind) + " 不存在")
+	}
+	if a.Name == "" {
+		return badRequest("name 不能为空")
+	}
+	if a.Threshold <= 0 {
+		return badRequest("requirement 必须大于 0")
+	}
+	switch a.Kind {
+	case models.RuleTimeOfDay:
+		h := a.BeforeHour
+		if h == nil {
+			h = a.AfterHour
+		}
+		if h == nil || *h < 0 || *h > 23 {
+			return badRequest("time_of_day 需要 0~23 之间的 before_hour 或 after_hour")
+		}
+	case models.RuleCountdownRate:
+		if a.Threshold > 100 {
+			return badRequest("countdown_rate 的 requirement 是百分比，不能超过 100")
+		}
+	}
+	if !models.ValidTier(a.Tier) {
+		return badRequest("tier 只支持 bronze、silver、gold")
+	}
+	if a.Tier != "" && a.Group == "" {
+		return badRequest("分级成就需要 group")
+	}
+	return nil
+}
+
+// allAchievements 全部成就定义（含停用的）
+func allAchievements(db *gorm.DB) ([]models.Achievement, error) {
+	var defs []models.Achievement
+	err := db.Order("sort_order ASC, id ASC").Find(&defs).Error
+	return defs, err
+}
+
+// snapshotAchievements 保存一份当前全部定义的快照作为新版本
+func snapshotAchievements(tx *gorm.DB, action string, id *int, note string) error {
+	defs, err := allAchievements(tx)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(defs)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.AchievementVersion{
+		Action:        action,
+		AchievementID: id,
+		Note:          note,
+		Snapshot:      string(b),
+	}).Error
+}
+
+// achievementReq 管理接口创建/修改成就的请求体，只合并传了的字段
+type achievementReq struct {
+	ID          *int    `json:"id"`
+	Name        *string `json:"name"`
+	Content     *string `json:"content"`
+	Subtitle    *string `json:"subtitle"`
+	Achievement *string `json:"achievement"`
+	Threshold   *int64  `json:"requirement"`
+	Kind        *string `json:"kind"`
+	BeforeHour  *int    `json:"before_hour"` // 与 after_hour 二选一，设置一个会清掉另一个
+	AfterHour   *int    `json:"after_hour"`
+	MinMinutes  *int    `json:"min_minutes"`
+	MinCount    *int    `json:"min_count"`
+	SortOrder   *int    `json:"sort_order"`
+	Hidden      *bool   `json:"hidden"`
+	Group       *string `json:"group"`
+	Tier        *string `json:"tier"`
+	Disabled    *bool   `json:"disabled"`
+	Note        string  `json:"note"` // 写进版本记录的说明
+}
+
+// apply 把传了的字段合并到 a 上并校验
+func (r achievementReq) apply(a *models.Achievement) error {
+	// id 为 0 时 GORM 会改为自增分配，不是管理员要的那个
+	if r.ID != nil && *r.ID <= 0 {
+		return badRequest("id 必须是正整数")
+	}
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set(&a.Name, r.Name)
+	set(&a.Content, r.Content)
+	set(&a.Subtitle, r.Subtitle)
+	set(&a.Achievement, r.Achievement)
+	set(&a.Kind, r.Kind)
+	set(&a.Group, r.Group)
+	set(&a.Tier, r.Tier)
+	if r.Threshold != nil {
+		a.Threshold = *r.Threshold
+	}
+	if r.BeforeHour != nil {
+		a.BeforeHour, a.AfterHour = r.BeforeHour, nil
+	}
+	if r.AfterHour != nil {
+		a.AfterHour, a.BeforeHour = r.AfterHour, nil
+	}
+	if r.MinMinutes != nil {
+		a.MinMinutes = *r.MinMinutes
+	}
+	if r.MinCount != nil {
+		a.MinCount = *r.MinCount
+	}
+	if r.SortOrder != nil {
+		a.SortOrder = *r.SortOrder
+	}
+	if r.Hidden != nil {
+		a.Hidden = *r.Hidden
+	}
+	if r.Disabled != nil {
+		a.Disabled = *r.Disabled
+	}
+	return validateAchievement(a)
+}
+
+// AdminListAchievements GET /api/v1/admin/achievements  全部成就定义（含停用的）
+func (f *Focus) AdminListAchievements(c *gin.Context) {
+	defs, err := allAchievements(f.DB)
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, defs)
+}
+
+// AdminCreateAchievement POST /api/v1/admin/achievements[?dry_run=true]
+// 不传 id 时取当前最大 id + 1，不传 sort_order 时排在最后；dry_run 时只返回预览，不保存
+func (f *Focus) AdminCreateAchievement(c *gin.Context) {
+	var req achievementReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	var a models.Achievement
+	err := req.apply(&a)
+	if err == nil && c.Query("dry_run") == "true" {
+		f.previewAchievement(c, a)
+		return
+	}
+	if err == nil {
+		err = f.DB.Transaction(func(tx *gorm.DB) error {
+			var last struct{ ID, SortOrder int }
+			tx.Model(&models.Achievement{}).
+				Select("COALESCE(MAX(id), 0) AS id, COALESCE(MAX(sort_order), 0) AS sort_order").Scan(&last)
+			a.ID = last.ID + 1
+			if req.ID != nil {
+				a.ID = *req.ID
+				var n int64
+				tx.Model(&models.Achievement{}).Where("id=?", a.ID).Count(&n)
+				if n > 0 {
+					return errAchievementExists
+				}
+			}
+			if a.SortOrder == 0 {
+				a.SortOrder = last.SortOrder + 1
+			}
+			if err := tx.Create(&a).Error; err != nil {
+				return err
+			}
+			return snapshotAchievements(tx, "create", &a.ID, req.Note)
+		})
+	}
+	if err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, a)
+}
+
+// AdminUpdateAchievement PATCH /api/v1/admin/achievements/:id[?dry_run=true]
+// 修改文案、规则参数、隐藏/分级/停用状态；规则变了的成就清掉保存的进度，下次查看时按新规则重新评估
+// 已解锁的记录不受影响
+func (f *Focus) AdminUpdateAchievement(c *gin.Context) {
+	a, err := f.findAchievement(c.Param("id"))
+	if err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	var req achievementReq
+	if err := c.ShouldBindJSON(&req); err != nil || (req.ID != nil && *req.ID != a.ID) {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	err = req.apply(&a)
+	if err == nil && c.Query("dry_run") == "true" {
+		f.previewAchievement(c, a)
+		return
+	}
+	if err == nil {
+		err = f.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&a).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("achievement_id=?", a.ID).Delete(&models.AchievementProgress{}).Error; err != nil {
+				return err
+			}
+			return snapshotAchievements(tx, "update", &a.ID, req.Note)
+		})
+	}
+	if err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, a)
+}
+
+// AdminDisableAchievement DELETE /api/v1/admin/achievements/:id  停用成就（不删除，已解锁的记录保留，可通过 PATCH 重新启用）
+func (f *Focus) AdminDisableAchievement(c *gin.Context) {
+	a, err := f.findAchievement(c.Param("id"))
+	if err == nil {
+		err = f.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&a).Update("disabled", true).Error; err != nil {
+				return err
+			}
+			return snapshotAchievements(tx, "disable", &a.ID, "")
+		})
+	}
+	if err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// AdminReorderAchievements POST /api/v1/admin/achievements/reorder  body: {"ids":[3,1,2]}，按给定顺序重排
+// 可以只传一部分：没列出的成就保持原有的相对顺序排在后面，重排后 sort_order 从 1 连续编号
+func (f *Focus) AdminReorderAchievements(c *gin.Context) {
+	var req struct {
+		IDs []int `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(400, gin.H{"message": "无效的ids"})
+		return
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		defs, err := allAchievements(tx)
+		if err != nil {
+			return err
+		}
+		known := make(map[int]bool, len(defs))
+		for _, a := range defs {
+			known[a.ID] = true
+		}
+		listed := make(map[int]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if !known[id] {
+				return badRequest("成就 " + strconv.Itoa(id) + " 不存在")
+			}
+			if listed[id] {
+				return badRequest("成就 " + strconv.Itoa(id) + " 重复")
+			}
+			listed[id] = true
+		}
+		order := append([]int{}, req.IDs...)
+		for _, a := range defs {
+			if !listed[a.ID] {
+				order = append(order, a.ID)
+			}
+		}
+		for i, id := range order {
+			if err := tx.Model(&models.Achievement{}).
+				Where("id=?", id).Update("sort_order", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return snapshotAchievements(tx, "reorder", nil, "")
+	})
+	if err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// AdminPreviewAchievement POST /api/v1/admin/achievements/preview  body 同创建
+// 不保存，返回用户看到的效果与试运行结果
+func (f *Focus) AdminPreviewAchievement(c *gin.Context) {
+	var req achievementReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	var a models.Achievement
+	if req.ID != nil {
+		a.ID = *req.ID
+	}
+	if err := req.apply(&a); err != nil {
+		c.JSON(adminStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	f.previewAchievement(c, a)
+}
+
+// ownerKeyExpr 在 SQL 里拼出与 owner.key() 相同的归属者标识，t 为表别名
+func ownerKeyExpr(t string) string {
+	return "CASE WHEN " + t + ".user_id IS NOT NULL THEN 'u:' || " + t + ".user_id ELSE 'v:' || " + t + ".visitor_id END"
+}
+
+// achievementCohorts 规则类型 -> 一次算出所有归属者进度的查询（owner_key, value），试运行用
+// 口径与 achievementRules 一致，新增规则类型时两边都要注册
+var achievementCohorts = map[string]func(db *gorm.DB, a models.Achievement) *gorm.DB{
+	models.RuleCumulativeTime: func(db *gorm.DB, _ models.Achievement) *gorm.DB {
+		return db.Table("daily_stats").Select("owner_key, SUM(seconds) AS value").Group("owner_key")
+	},
+	models.RuleSessionCount: func(db *gorm.DB, _ models.Achievement) *gorm.DB {
+		return db.Table("daily_stats").Select("owner_key, SUM(sessions) AS value").Group("owner_key")
+	},
+	models.RuleSessionLength: func(db *gorm.DB, _ models.Achievement) *gorm.DB {
+		return db.Table("sessions s").Select(ownerKeyExpr("s") + " AS owner_key, MAX(s.duration_sec) AS value").
+			Where("s.status='finished' AND s.deleted_at IS NULL").Group("1")
+	},
+	models.RuleStreak: func(db *gorm.DB, a models.Achievement) *gorm.DB {
+		// 连续日期减去行号得到相同的值，按它分组就是一段段连续的天
+		runs := db.Table("daily_stats").
+			Select("owner_key, day - (ROW_NUMBER() OVER (PARTITION BY owner_key ORDER BY day))::int AS grp").
+			Where("seconds >= ?", max(a.MinMinutes, 1)*60)
+		lens := db.Table("(?) r", runs).Select("owner_key, COUNT(*) AS n").Group("owner_key, grp")
+		return db.Table("(?) l", lens).Select("owner_key, MAX(n) AS value").Group("owner_key")
+	},
+	models.RuleTimeOfDay: func(db *gorm.DB, a models.Achievement) *gorm.DB {
+		q := db.Table("sessions s").Select(ownerKeyExpr("s") + " AS owner_key, COUNT(*) AS value").
+			Joins(`LEFT JOIN preferences p ON (s.user_id IS NOT NULL AND p.user_id = s.user_id)
+				OR (s.user_id IS NULL AND p.user_id IS NULL AND p.visitor_id = s.visitor_id)`).
+			Where("s.status='finished' AND s.deleted_at IS NULL").Group("1")
+		hour := "EXTRACT(HOUR FROM s.start_at AT TIME ZONE COALESCE(NULLIF(p.timezone, ''), ?))"
+		if a.BeforeHour != nil {
+			return q.Where(hour+" < ?", config.DefaultTimezone(), *a.BeforeHour)
+		}
+		return q.Where(hour+" >= ?", config.DefaultTimezone(), *a.AfterHour)
+	},
+	models.RuleTaskCompletion: func(db *gorm.DB, _ models.Achievement) *gorm.DB {
+		return db.Table("tasks t").Select(ownerKeyExpr("t") + " AS owner_key, COUNT(*) AS value").
+			Where("t.status='done' AND t.deleted_at IS NULL").Group("1")
+	},
+	models.RuleCountdownRate: func(db *gorm.DB, a models.Achievement) *gorm.DB {
+		return db.Table("sessions s").
+			Select(ownerKeyExpr("s")+` AS owner_key,
+				COUNT(*) FILTER (WHERE s.status='finished' AND s.duration_sec >= s.planned_minutes * 60) * 100 / COUNT(*) AS value`).
+			Where(`s.deleted_at IS NULL AND s.mode IN ('countdown','pomodoro') AND s.status IN ('finished','canceled')
+				AND s.planned_minutes IS NOT NULL`).
+			Group("1").Having("COUNT(*) >= ?", max(a.MinCount, 1))
+	},
+}
+
+// previewAchievement 预览成就：未解锁与解锁后的展示效果，以及按现有数据试运行的结果——
+// 有数据的归属者数、其中已经达到门槛的人数、达到门槛且还没解锁（保存后会新解锁）的人数
+// 每个数字都是一条分组查询，不逐个归属者评估
+func (f *Focus) previewAchievement(c *gin.Context, a models.Achievement) {
+	var owners int64
+	if err := f.DB.Raw(`SELECT COUNT(*) FROM (SELECT ` + ownerKeyExpr("s") + ` FROM sessions s WHERE s.deleted_at IS NULL
+		UNION SELECT ` + ownerKeyExpr("t") + ` FROM tasks t WHERE t.deleted_at IS NULL) o`).
+		Scan(&owners).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	var dry struct{ Qualified, WouldUnlock int64 }
+	if err := f.DB.Raw(`SELECT COUNT(*) FILTER (WHERE v.value >= ?) AS qualified,
+			COUNT(*) FILTER (WHERE v.value >= ? AND ua.owner_key IS NULL) AS would_unlock
+		FROM (?) v LEFT JOIN user_achievements ua ON ua.owner_key = v.owner_key AND ua.achievement_id = ?`,
+		a.Threshold, a.Threshold, achievementCohorts[a.Kind](f.DB, a), a.ID).
+		Scan(&dry).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+
+	done := a
+	done.Unlocked = true
+	c.JSON(200, gin.H{
+		"achievement": a,
+		"preview": gin.H{
+			"locked":   newAchievementView(a, 0),
+			"unlocked": newAchievementView(done, a.Threshold),
+		},
+		"dry_run": gin.H{
+			"owners":       owners,
+			"qualified":    dry.Qualified,
+			"would_unlock": dry.WouldUnlock,
+		},
+	})
+}
+
+// AdminAchievementVersions GET /api/v1/admin/achievements/versions  定义的历史版本，新的在前
+func (f *Focus) AdminAchievementVersions(c *gin.Context) {
+	var vs []models.AchievementVersion
+	if err := f.DB.Order("id DESC").Limit(100).Find(&vs).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, vs)
+}
+
+// AdminRollbackAchievements POST /api/v1/admin/achievements/versions/:version/rollback
+// 把全部定义恢复成某个版本的快照，回滚本身也记为一个新版本；保存的进度清空后按恢复的规则重新评估，已解锁的记录保留
+func (f *Focus) AdminRollbackAchievements(c *gin.Context) {
+	var v models.AchievementVersion
+	id, err := strconv.ParseUint(c.Param("version"), 10, 64)
+	if err != nil || f.DB.Take(&v, id).Error != nil {
+		c.JSON(404, gin.H{"message": errVersionNotFound.Error()})
+		return
+	}
+	var defs []models.Achievement
+	if err := json.Unmarshal([]byte(v.Snapshot), &defs); err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	err = f.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("true").Delete(&models.Achievement{}).Error; err != nil {
+			return err
+		}
+		if len(defs) > 0 {
+			if err := tx.Create(&defs).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("true").Delete(&models.AchievementProgress{}).Error; err != nil {
+			return err
+		}
+		return snapshotAchievements(tx, "rollback", nil, "回滚到版本 "+strconv.FormatUint(id, 10))
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, defs)
+}
+
+// findAchievement 按路径参数查找成就定义（含停用的）
+func (f *Focus) findAchievement(idStr string) (models.Achievement, error) {
+	var a models.Achievement
+	id, err := strconv.Atoi(idStr)
+	if err != nil || f.DB.Take(&a, id).Error != nil {
+		return a, errAchievementNotFound
+	}
+	return a, nil
+}
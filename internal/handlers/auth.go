@@ -1,56 +1,82 @@
 package handlers
 
 import (
+	"errors"
 	"time"
 
-	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// 鉴权中间件把身份写入 gin.Context 时使用的 key
+const (
+	CtxVisitorID = "vid" // 游客 ID（string）
+	CtxUserID    = "uid" // 已注册用户 ID（uint），游客没有
+	CtxFamilyID  = "fid" // 当前 access token 所属的 refresh token 家族
+)
+
 // IssueVisitorID 生成游客 cookie 用的 uuid
 func IssueVisitorID() string { return uuid.NewString() }
 
-// 简单签发 JWT（给前端存 localStorage 用）
-func signGuestToken(secret, visitorID string) (string, error) {
+// 简单签发短期 access token（JWT，给前端存 localStorage 用）
+// userID 为 0 表示游客；已注册用户额外带上 uid；fid 指向签发它的 refresh token 家族，家族被吊销后立即失效
+func signToken(secret, visitorID string, userID uint, familyID string, ttl time.Duration) (string, error) {
 	claims := jwt.MapClaims{
 		"vid":  visitorID,
+		"fid":  familyID,
 		"role": "guest",
 		"iat":  time.Now().Unix(),
-		"exp":  time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"exp":  time.Now().Add(ttl).Unix(),
+	}
+	if userID != 0 {
+		claims["uid"] = userID
+		claims["role"] = "user"
 	}
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return t.SignedString([]byte(secret))
 }
 
+// ParseToken 校验 JWT 的签名（仅接受 HS256）与过期时间，返回其中的 claims
+func ParseToken(secret, tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if vid, _ := claims["vid"].(string); vid == "" {
+		return nil, errors.New("token 缺少 vid")
+	}
+	return claims, nil
+}
+
 // GuestLogin POST /guest-login
-// 返回 token（不返回 username）
-func GuestLogin(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		vid, _ := c.Cookie("tcid") // 有则复用
-		if vid == "" {
-			vid = IssueVisitorID()
-			// SameSite=Lax + HttpOnly；上线到 HTTPS 后可把 secure=true
-			c.SetCookie("tcid", vid, 3600*24*365, "/", "", false, true)
-		}
-		token, err := signGuestToken(cfg.JWTSecret, vid)
-		if err != nil {
-			c.JSON(500, gin.H{"code": 500, "message": "token错误"})
-			return
-		}
-		c.JSON(200, gin.H{"token": token})
+// 返回 access token 与 refresh token（不返回 username）
+func (a *Account) GuestLogin(c *gin.Context) {
+	vid, _ := c.Cookie("tcid") // 有则复用
+	if vid == "" {
+		vid = IssueVisitorID()
+		// SameSite=Lax + HttpOnly；上线到 HTTPS 后可把 secure=true
+		c.SetCookie("tcid", vid, 3600*24*365, "/", "", false, true)
 	}
+	a.respondTokens(c, vid, 0, nil)
 }
 
 // GET /me  仅用于校验/拿 visitorId（不返回 username）
+// visitorId 由鉴权中间件从 token（或兼容模式下的 cookie）中解析
 func Me() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		vid, err := c.Cookie("tcid")
-		if err != nil || vid == "" {
+		vid := c.GetString(CtxVisitorID)
+		if vid == "" {
 			c.JSON(401, gin.H{"code": 401, "message": "未授权"})
 			return
 		}
-		c.JSON(200, gin.H{"visitorId": vid})
+		resp := gin.H{"visitorId": vid}
+		if uid := c.GetUint(CtxUserID); uid != 0 {
+			resp["userId"] = uid
+		}
+		c.JSON(200, resp)
 	}
 }
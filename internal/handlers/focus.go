@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -8,26 +10,71 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
 )
 
 type Focus struct {
-	DB *gorm.DB
+	DB  *gorm.DB
+	Cfg *config.Config
 }
 
-func NewFocus(db *gorm.DB) *Focus { return &Focus{DB: db} }
+func NewFocus(db *gorm.DB, cfg *config.Config) *Focus {
+	return &Focus{DB: db, Cfg: cfg}
+}
 
-// visitorID 从 cookie 中取游客 ID（tcid）
-// 返回 ID 字符串和是否成功（cookie 存在且不为空）
-func (f *Focus) visitorID(c *gin.Context) (string, bool) {
-	vid, err := c.Cookie("tcid")
-	return vid, err == nil && vid != ""
+// owner 数据归属：已注册用户按 user_id 归属，游客按 visitor_id 归属
+type owner struct {
+	VisitorID string
+	UserID    *uint
 }
 
+// scope 把查询限定在该归属者的数据上（GORM Scopes 用）
+// 游客只看 user_id 为空的数据，避免看到已归属到账号下的记录
+func (o owner) scope(db *gorm.DB) *gorm.DB {
+	if o.UserID != nil {
+		return db.Where("user_id=?", *o.UserID)
+	}
+	return db.Where("visitor_id=? AND user_id IS NULL", o.VisitorID)
+}
+
+// key 归属者的字符串标识：用户为 u:<id>，游客为 v:<visitor_id>
+func (o owner) key() string {
+	if o.UserID != nil {
+		return fmt.Sprintf("u:%d", *o.UserID)
+	}
+	return "v:" + o.VisitorID
+}
+
+// OwnerKey 当前请求归属者的字符串标识（供中间件等按归属者区分数据），没有身份时返回空串
+func OwnerKey(c *gin.Context) string {
+	o, ok := ownerFrom(c)
+	if !ok {
+		return ""
+	}
+	return o.key()
+}
+
+// ownerFrom 取鉴权中间件写入上下文的游客 ID 与用户 ID
+// 返回归属者和是否成功（token 或兼容 cookie 有效且游客 ID 不为空）
+func ownerFrom(c *gin.Context) (owner, bool) {
+	o := owner{VisitorID: c.GetString(CtxVisitorID)}
+	if uid := c.GetUint(CtxUserID); uid != 0 {
+		o.UserID = &uid
+	}
+	return o, o.VisitorID != ""
+}
+
+func (f *Focus) owner(c *gin.Context) (owner, bool) { return ownerFrom(c) }
+
 // POST /api/v1/sessions/start
 type startReq struct {
-	Mode           string  `json:"mode"` // stopwatch|countdown
-	PlannedMinutes *int    `json:"planned_minutes"`
-	TaskName       *string `json:"task_name"`
+	Mode           string   `json:"mode"` // stopwatch|countdown
+	PlannedMinutes *int     `json:"planned_minutes"`
+	TaskName       *string  `json:"task_name"`
+	TaskID         *uint    `json:"task_id"` // 关联任务，不传 task_name 时沿用任务标题
+	Tags           []string `json:"tags"`    // 标签名，不存在的自动创建
+	// Heartbeat 客户端会定时发心跳；开始即视为一次心跳，页面在第一次心跳前关掉也会被自动暂停
+	Heartbeat bool `json:"heartbeat"`
 }
 
 func (f *Focus) Start(c *gin.Context) {
@@ -36,60 +83,92 @@ func (f *Focus) Start(c *gin.Context) {
 	if req.Mode != "stopwatch" && req.Mode != "countdown" {
 		req.Mode = "stopwatch"
 	}
-	vid, ok := f.visitorID(c)
+	// 倒计时由服务端到点自动结束，必须给出计划时长（1 分钟 ~ 24 小时）
+	if req.Mode == "countdown" && (req.PlannedMinutes == nil || *req.PlannedMinutes < 1 || *req.PlannedMinutes > 24*60) {
+		c.JSON(400, gin.H{"message": "倒计时需要设置 planned_minutes（1~1440）"})
+		return
+	}
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
 	sess := models.Session{
-		VisitorID:      vid,
+		VisitorID:      o.VisitorID,
+		UserID:         o.UserID,
 		Mode:           req.Mode,
 		PlannedMinutes: req.PlannedMinutes,
-		TaskName:       req.TaskName,
-		Status:         "started",
+		TaskID:         req.TaskID,
+		StartAt:        time.Now(),
 	}
-	if err := f.DB.Create(&sess).Error; err != nil {
-		c.JSON(500, gin.H{"message": err.Error()})
+	if req.Heartbeat {
+		sess.LastHeartbeatAt = &sess.StartAt
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sess.TaskName, err = f.resolveTask(tx, o, req.TaskID, req.TaskName); err != nil {
+			return err
+		}
+		if sess.Tags, err = resolveTags(tx, o, req.Tags); err != nil {
+			return err
+		}
+		return createSession(tx, o, &sess, f.Cfg.StartConflict)
+	})
+	if err != nil {
+		c.JSON(lifecycleStatus(err), gin.H{"message": err.Error()})
 		return
 	}
-	seg := models.Segment{SessionID: sess.ID}
-	_ = f.DB.Create(&seg).Error
 	c.JSON(200, gin.H{
 		"session_id": sess.ID,
-		"status":     "started",
+		"status":     sess.Status,
 		"started_at": sess.StartAt.UTC(),
 	})
 }
 
+// POST /api/v1/sessions/pause 的可选 body
+type pauseReq struct {
+	Reason string `json:"reason"` // internal、external、break，不传记为 unspecified
+	Note   string `json:"note"`
+}
+
 // Pause 暂停当前计时会话
-// 逻辑：结束当前片段的计时，保存累计秒数，改状态为 paused
+// 逻辑：结束当前片段的计时，保存累计秒数，改状态为 paused，并记一条中断
 func (f *Focus) Pause(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
-	sess, ok := f.findMutable(vid)
-	if !ok || sess.Status != "started" {
+	var req pauseReq
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = models.InterruptionUnspecified
+	} else if !models.ValidInterruptionReason(req.Reason) {
+		c.JSON(400, gin.H{"message": "reason 只支持 internal、external、break"})
+		return
+	}
+	if len([]rune(req.Note)) > 200 {
+		c.JSON(400, gin.H{"message": "备注不能超过 200 字"})
+		return
+	}
+	var total int64
+	_, err := f.transition(o, models.SessionPaused, func(tx *gorm.DB, sess models.Session, now time.Time) error {
+		var err error
+		if total, err = pauseSession(tx, sess, now); err != nil {
+			return err
+		}
+		return recordInterruption(tx, sess.ID, now, req.Reason, req.Note)
+	})
+	if errors.Is(err, errNoActive) || errors.Is(err, errIllegalTransition) {
 		c.JSON(400, gin.H{"message": "专注未开始"})
 		return
 	}
-	now := time.Now()
-
-	// 结束最后一个未结束的片段（记录片段的结束时间）
-	f.DB.Model(&models.Segment{}).
-		Where("session_id=? AND end_at IS NULL", sess.ID).
-		Update("end_at", &now)
-
-	// 计算本次会话已用的总秒数并更新会话状态
-	total := f.totalSeconds(sess.ID)
-	f.DB.Model(&models.Session{}).Where("id=?", sess.ID).
-		Updates(map[string]any{
-			"status":       "paused",
-			"duration_sec": total,
-		})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
 	c.JSON(200, gin.H{
-		"status":    "paused",
+		"status":    models.SessionPaused,
 		"total_sec": total,
 	})
 }
@@ -97,76 +176,70 @@ func (f *Focus) Pause(c *gin.Context) {
 // Resume 恢复暂停的计时会话
 // 逻辑：新建一个片段（开始新的计时），改状态为 started
 func (f *Focus) Resume(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
-	sess, ok := f.findMutable(vid)
-	if !ok || sess.Status != "paused" {
+	_, err := f.transition(o, models.SessionStarted, func(tx *gorm.DB, sess models.Session, now time.Time) error {
+		return resumeSession(tx, sess, now)
+	})
+	if errors.Is(err, errNoActive) || errors.Is(err, errIllegalTransition) {
 		c.JSON(400, gin.H{"message": "没有可继续的专注事件"})
 		return
 	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": models.SessionStarted})
+}
 
-	// 新开一个片段（记录新的开始时间）
-	_ = f.DB.Create(&models.Segment{SessionID: sess.ID}).Error
-	f.DB.Model(&models.Session{}).Where("id=?", sess.ID).
-		Update("status", "started")
-	c.JSON(200, gin.H{"status": "started"})
+// POST /api/v1/sessions/finish  body 可选：{"tags":["数学"]}
+type finishReq struct {
+	Tags *[]string `json:"tags"`
 }
 
 // Finish 完成计时会话
 // 收口所有片段，计算总秒数，若小于 1 分钟视为无效，否则创建成长事件
+// 整个过程在一个事务内并锁住会话，重复点击的第二次请求会因为会话已结束而被拒绝，不会重复创建成长事件
 func (f *Focus) Finish(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
-	sess, ok := f.findMutable(vid)
-	if !ok {
-		c.JSON(400, gin.H{"message": "没有正在进行的专注"})
-		return
-	}
-	now := time.Now()
-
-	// 收口当前片段（把未结束的 seg 结束掉）
-	f.DB.Model(&models.Segment{}).
-		Where("session_id=? AND end_at IS NULL", sess.ID).
-		Update("end_at", &now)
-
-	// 统计本次秒数
-	total := f.totalSeconds(sess.ID)
+	var req finishReq
+	_ = c.ShouldBindJSON(&req)
 
-	// 少于 1 分钟视为太短（短短的也很可爱呢:)）
-	minLimit := int64(60)
-	if total < minLimit {
-		c.String(400, "结束太快了不会计入总时长哦，至少大于一分钟喵~")
+	var total int64
+	var minutes int
+	sess, err := f.transition(o, models.SessionFinished, func(tx *gorm.DB, sess models.Session, now time.Time) error {
+		var err error
+		if total, minutes, err = finishSession(tx, sess, now); err != nil {
+			return err
+		}
+		// 结束时可以补打/改写标签（传了 tags 就整体替换）
+		if req.Tags != nil {
+			tags, err := resolveTags(tx, o, *req.Tags)
+			if err != nil {
+				return err
+			}
+			return tx.Model(&sess).Association("Tags").Replace(tags)
+		}
+		return nil
+	})
+	if errors.Is(err, errTooShort) {
+		c.String(400, err.Error())
 		return
 	}
-	// 会话结束，并标记结束时间与总秒数
-	f.DB.Model(&models.Session{}).Where("id=?", sess.ID).
-		Updates(map[string]any{
-			"status":       "finished",
-			"end_at":       &now,
-			"duration_sec": total,
-		})
-
-	// 分钟数向上取整（61s -> 2min），且至少 1 分钟
-	// 用于统一计算成长值：比如 61 秒和 120 秒都算 2 分钟
-	minutes := int((total + 59) / 60)
-	if minutes < 1 {
-		minutes = 1
+	if err != nil {
+		c.JSON(lifecycleStatus(err), gin.H{"message": err.Error()})
+		return
 	}
-	// 创建成长事件记录，供前端和宠物系统使用
-	_ = f.DB.Create(&models.GrowthEvent{
-		VisitorID: vid,
-		SessionID: sess.ID,
-		Minutes:   minutes,
-	}).Error
 
 	c.JSON(200, gin.H{
-		"status":       "finished",
+		"status":       models.SessionFinished,
 		"session_id":   sess.ID,
 		"duration_sec": total,
 		"minutes":      minutes,
@@ -175,114 +248,99 @@ func (f *Focus) Finish(c *gin.Context) {
 
 // Cancel POST /api/v1/sessions/cancel
 func (f *Focus) Cancel(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
-	sess, ok := f.findMutable(vid)
-	if !ok {
-		c.JSON(400, gin.H{"message": "没有正在进行的专注"})
+	_, err := f.transition(o, models.SessionCanceled, func(tx *gorm.DB, sess models.Session, now time.Time) error {
+		return cancelSession(tx, sess, now)
+	})
+	if err != nil {
+		c.JSON(lifecycleStatus(err), gin.H{"message": err.Error()})
 		return
 	}
-	now := time.Now()
-	f.DB.Model(&models.Session{}).Where("id=?", sess.ID).
-		Updates(map[string]any{"status": "canceled", "end_at": &now})
-
-	// 把未结束的片段也收口
-	f.DB.Model(&models.Segment{}).Where("session_id=? AND end_at IS NULL", sess.ID).
-		Update("end_at", &now)
-	c.JSON(200, gin.H{"status": "canceled"})
+	c.JSON(200, gin.H{"status": models.SessionCanceled})
 }
 
 // Current GET /api/v1/sessions/current
+// 倒计时会话会多返回 remaining_sec
 func (f *Focus) Current(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
-	sess, ok := f.findMutable(vid)
+	sess, ok := f.findMutable(o)
 	if !ok {
 		c.JSON(200, nil)
 		return
 	}
 	elapsed := f.elapsedNow(sess.ID)
-	c.JSON(200, gin.H{
+	resp := gin.H{
 		"session_id":  sess.ID,
 		"status":      sess.Status,
 		"mode":        sess.Mode,
 		"started_at":  sess.StartAt.UTC(),
 		"elapsed_sec": elapsed,
-	})
+	}
+	// 倒计时额外返回剩余秒数（到 0 后由调度器自动结束）
+	if target, ok := countdownTarget(sess); ok {
+		resp["remaining_sec"] = max(target-elapsed, 0)
+	}
+	// 心跳超时被服务端暂停的，前端可以提示用户继续
+	if sess.AutoPaused {
+		resp["auto_paused"] = true
+	}
+	c.JSON(200, resp)
 }
 
 // Summary 获取统计数据：今日时长/次数、近 7 天每天分钟、总分钟
-// 逻辑：分别查询三个时间段内已完成的会话，累计计算分钟数
+// 逻辑：按天的分钟数与次数由数据库聚合（见 dailyTotals），总分钟直接汇总每日汇总表
 func (f *Focus) Summary(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
 	}
 
-	// 使用 UTC 时间进行计算，避免时区混乱
-	now := time.Now().UTC()
+	// 按用户时区切分日期（见 location），今天指当地的 0 点起
+	loc := f.location(c, o)
+	startOfDay := dayStart(time.Now(), loc)
 
-	// 今日完成的会话（从今天 UTC 00:00:00 起）
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
-	var today []models.Session
-	f.DB.Where("visitor_id=? AND status='finished' AND end_at >= ?", vid, startOfDay).
-		Find(&today)
-	todayMin := 0
-	for _, s := range today {
-		todayMin += int(s.DurationSec / 60)
-	}
+	// 近 7 天（含今天）每天的汇总，由数据库按天聚合（见 dailyTotals）
+	days := f.dailyTotals(o, loc, addDays(startOfDay, -6), addDays(startOfDay, 1))
+	today := days[startOfDay.Format("2006-01-02")]
+	todayMin := today.Seconds / 60
 
-	// 近 7 天（含今天）的数据，用 Go 填充为 0（没有数据的日期也显示为 0）
+	// 构造返回的 7 天数组，没有数据的日期也显示为 0
 	last7 := make([]map[string]any, 0, 7)
-	dayMap := map[string]int{}
-
-	// 找出近 7 天已完成的会话，累计每天的分钟数
-	weekAgo := time.Now().AddDate(0, 0, -6)
-	var all []models.Session
-	f.DB.Where("visitor_id=? AND status='finished' AND end_at >= ?", vid, weekAgo).Find(&all)
-
-	for _, s := range all {
-		//安全处理 EndAt 指针，使用 UTC 时间
-		if s.EndAt != nil {
-			// 使用 UTC 时间进行计算
-			endUTC := *s.EndAt // s.EndAt 已经是 UTC 时间
-			dateKey := time.Date(endUTC.Year(), endUTC.Month(), endUTC.Day(), 0, 0, 0, 0, time.UTC).Format("2006-01-02")
-			dayMap[dateKey] += int(s.DurationSec / 60)
-		}
-	}
-
-	// 构造返回的 7 天数组，往前推六天
-	for i := 0; i < 7; i++ {
-		date := startOfDay.AddDate(0, 0, -i)
-		dateStr := date.Format("2006-01-02")
-		last7 = append([]map[string]any{
-			{
-				"date":    dateStr,
-				"minutes": dayMap[dateStr],
-			},
-		}, last7...) // 插入到前面，保持日期顺序
+	for i := 6; i >= 0; i-- {
+		dateStr := addDays(startOfDay, -i).Format("2006-01-02")
+		last7 = append(last7, map[string]any{
+			"date":    dateStr,
+			"minutes": days[dateStr].Seconds / 60,
+		})
 	}
 
 	// 总分钟（全历史）
-	var total []models.Session
-	f.DB.Where("visitor_id=? AND status='finished'", vid).Find(&total)
-	totalMin := 0
-	for _, s := range total {
-		totalMin += int(s.DurationSec / 60)
-	}
+	totalMin := f.totalFocusSeconds(o) / 60
+
+	st := f.computeStreaks(o, loc, f.streakMinMinutes(c))
 
 	c.JSON(200, gin.H{
 		"today_minutes": todayMin,
-		"today_count":   len(today),
+		"goals":         f.currentGoals(o, loc, true), // 启用中的目标在当前周期的进度
+		"today_count":   today.Sessions,
 		"last7d":        last7,
 		"total_minutes": totalMin,
+		"timezone":      loc.String(),
+		"streak": gin.H{
+			"current":       st.Current,
+			"longest":       st.Longest,
+			"today_done":    st.TodayDone,
+			"freeze_tokens": st.FreezeTokens,
+		},
 	})
 }
 
@@ -291,7 +349,7 @@ func (f *Focus) Summary(c *gin.Context) {
 // GrowthPull 拉取该游客未处理的成长事件
 // 支持 limit 参数（默认 50，上限 200），按事件 ID 升序返回
 func (f *Focus) GrowthPull(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
@@ -305,7 +363,7 @@ func (f *Focus) GrowthPull(c *gin.Context) {
 	}
 	// 查询未处理的事件，按 ID 升序排列（保证顺序）
 	var evs []models.GrowthEvent
-	f.DB.Where("visitor_id=? AND handled=false", vid).
+	f.DB.Scopes(o.scope).Where("handled=false").
 		Order("id ASC").Limit(limit).Find(&evs)
 	c.JSON(200, evs)
 }
@@ -317,7 +375,7 @@ type ackReq struct {
 }
 
 func (f *Focus) GrowthAck(c *gin.Context) {
-	vid, ok := f.visitorID(c)
+	o, ok := f.owner(c)
 	if !ok {
 		c.JSON(401, gin.H{"message": "无访客"})
 		return
@@ -329,33 +387,37 @@ func (f *Focus) GrowthAck(c *gin.Context) {
 	}
 	// 将 ≤ last_id 的所有事件标记为已处理，防止重复拉取
 	f.DB.Model(&models.GrowthEvent{}).
-		Where("visitor_id=? AND id <= ?", vid, req.LastID).
+		Scopes(o.scope).Where("id <= ?", req.LastID).
 		Update("handled", true)
 	c.JSON(200, gin.H{"ok": true})
 }
 
-// findMutable 查找该游客最近一条可变更的会话（状态为 started 或 paused）
+// findMutable 查找该归属者最近一条可变更的会话（状态为 started 或 paused）
 // 这样可以确保同一时间只有一个活跃会话被修改
-func (f *Focus) findMutable(visitorID string) (models.Session, bool) {
+func (f *Focus) findMutable(o owner) (models.Session, bool) {
 	var s models.Session
-	err := f.DB.Where("visitor_id=? AND status IN ('started','paused')", visitorID).
+	err := f.DB.Scopes(o.scope).Where("status IN ('started','paused')").
 		Order("start_at DESC").Take(&s).Error
 	return s, err == nil
 }
 
-// totalSeconds 计算会话的总计时秒数
-// 逻辑：遍历所有片段，对每个片段计算 end_at - start_at 的秒数，然后累加
-// 如果片段还未结束（end_at 为 nil），则用当前时间作为 end_at 进行计算
+// totalSeconds 计算会话截至当前的总计时秒数
 func (f *Focus) totalSeconds(sessionID uint) int64 {
+	return totalSecondsAt(f.DB, sessionID, time.Now())
+}
+
+// totalSecondsAt 计算会话截至 at 时刻的总计时秒数
+// 逻辑：遍历所有片段，对每个片段计算 end_at - start_at 的秒数，然后累加
+// 如果片段还未结束（end_at 为 nil），则用 at 作为 end_at 进行计算
+func totalSecondsAt(db *gorm.DB, sessionID uint, at time.Time) int64 {
 	var segs []models.Segment
-	f.DB.Where("session_id=?", sessionID).Find(&segs)
+	db.Where("session_id=?", sessionID).Find(&segs)
 	var sum int64
-	now := time.Now()
 	for _, sg := range segs {
 		end := sg.EndAt
-		// 如果片段未结束，用当前时间作为结束时间
+		// 如果片段未结束，用 at 作为结束时间
 		if end == nil {
-			e := now
+			e := at
 			end = &e
 		}
 		// 累加片段耗时（秒数）
@@ -364,40 +426,114 @@ func (f *Focus) totalSeconds(sessionID uint) int64 {
 	return sum
 }
 
-func (f *Focus) elapsedNow(sessionID uint) int64 {
-	return f.totalSeconds(sessionID)
+// errTooShort 少于 1 分钟的会话不计入总时长（短短的也很可爱呢:)）
+var errTooShort = errors.New("结束太快了不会计入总时长哦，至少大于一分钟喵~")
+
+// finishSession 在 at 时刻结束会话：收口所有片段、写入结束时间与总秒数，并创建成长事件
+// 总秒数不足 1 分钟时不做任何修改，返回 errTooShort
+// 返回总秒数与计入成长值的分钟数
+func finishSession(db *gorm.DB, sess models.Session, at time.Time) (int64, int, error) {
+	if !models.CanTransition(sess.Status, models.SessionFinished) {
+		return 0, 0, errIllegalTransition
+	}
+	// 统计本次秒数
+	total := totalSecondsAt(db, sess.ID, at)
+	if total < 60 {
+		return total, 0, errTooShort
+	}
+
+	// 收口当前片段（把未结束的 seg 结束掉）
+	if err := db.Model(&models.Segment{}).
+		Where("session_id=? AND end_at IS NULL", sess.ID).
+		Update("end_at", &at).Error; err != nil {
+		return 0, 0, err
+	}
+	// 会话结束，并标记结束时间与总秒数
+	if err := db.Model(&models.Session{}).Where("id=?", sess.ID).
+		Updates(map[string]any{
+			"status":       "finished",
+			"end_at":       &at,
+			"duration_sec": total,
+		}).Error; err != nil {
+		return 0, 0, err
+	}
+
+	minutes, err := creditFinished(db, sess, total, at)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, minutes, nil
 }
 
-// Achievements 返回总专注分钟数与已解锁的成就列表（阈值用秒对比）
-func (f *Focus) Achievements(c *gin.Context) {
-	vid, ok := f.visitorID(c)
-	if !ok {
-		c.JSON(401, gin.H{"message": "无访客"})
-		return
+// creditFinished 会话进入 finished 之后的连带处理：写成长事件，番茄钟工作阶段进入休息，刷新日汇总，检查目标与成就
+// 所有让会话变成 finished 的路径（结束、倒计时到点、离线同步）都走这里，返回计入的分钟数
+func creditFinished(db *gorm.DB, sess models.Session, total int64, at time.Time) (int, error) {
+	minutes := creditedMinutes(total)
+	// 创建成长事件记录，供前端和宠物系统使用
+	if err := db.Create(&models.GrowthEvent{
+		VisitorID: sess.VisitorID,
+		UserID:    sess.UserID,
+		Type:      models.GrowthFocus,
+		SessionID: sess.ID,
+		Minutes:   minutes,
+	}).Error; err != nil {
+		return 0, err
 	}
-	// 汇总该游客所有已完成会话的总秒数
-	var sessions []models.Session
-	f.DB.Where("visitor_id=? AND status='finished'", vid).Find(&sessions)
-	var totalSec int64
-	for _, s := range sessions {
-		totalSec += s.DurationSec
-	}
-
-	// 选择所有 threshold <= totalSec 的成就
-	resp := make([]models.Achievement, 0, len(models.Achievements))
-	for _, a := range models.Achievements {
-		resp = append(resp, models.Achievement{
-			ID:          a.ID,
-			Name:        a.Name,
-			Content:     a.Content,
-			Subtitle:    a.Subtitle,
-			Achievement: a.Achievement,
-			Threshold:   a.Threshold,
-			Unlocked:    totalSec >= a.Threshold,
-		})
+	// 番茄钟的工作阶段结束后进入休息阶段
+	if sess.CycleID != nil {
+		if err := enterBreak(db, *sess.CycleID, total, at); err != nil {
+			return 0, err
+		}
 	}
-	c.JSON(200, gin.H{
-		"total_minutes": totalSec / 60, // 方便前端展示
-		"achievements":  resp,
-	})
+	// 刷新结束当天的日汇总
+	if err := refreshRollup(db, sessionOwner(sess), at); err != nil {
+		return 0, err
+	}
+	// 这次专注让目标达成时发 goal_met 事件
+	if err := checkGoals(db, sess, at); err != nil {
+		return 0, err
+	}
+	// 增量更新成就进度，达到门槛的在这里解锁
+	if err := onSessionClosed(db, sess, total, true, at); err != nil {
+		return 0, err
+	}
+	return minutes, nil
+}
+
+// creditedMinutes 计入成长值的分钟数：向上取整（61s -> 2min），且至少 1 分钟
+// 用于统一计算成长值：比如 61 秒和 120 秒都算 2 分钟
+func creditedMinutes(total int64) int {
+	return max(int((total+59)/60), 1)
+}
+
+// cancelSession 在 at 时刻取消会话并收口未结束的片段，不计入时长
+// 番茄钟的工作阶段被取消时整轮番茄钟一起取消
+func cancelSession(db *gorm.DB, sess models.Session, at time.Time) error {
+	if !models.CanTransition(sess.Status, models.SessionCanceled) {
+		return errIllegalTransition
+	}
+	if err := db.Model(&models.Session{}).Where("id=?", sess.ID).
+		Updates(map[string]any{"status": "canceled", "end_at": &at}).Error; err != nil {
+		return err
+	}
+	// 把未结束的片段也收口
+	if err := db.Model(&models.Segment{}).Where("session_id=? AND end_at IS NULL", sess.ID).
+		Update("end_at", &at).Error; err != nil {
+		return err
+	}
+	// 取消数计入完成率
+	if err := refreshRollup(db, sessionOwner(sess), at); err != nil {
+		return err
+	}
+	if err := onSessionClosed(db, sess, 0, false, at); err != nil {
+		return err
+	}
+	if sess.CycleID != nil {
+		return stopCycle(db, *sess.CycleID, at)
+	}
+	return nil
+}
+
+func (f *Focus) elapsedNow(sessionID uint) int64 {
+	return f.totalSeconds(sessionID)
 }
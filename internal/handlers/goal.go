@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// goalProgress 目标在某个周期里的进度
+type goalProgress struct {
+	models.Goal
+	PeriodStart string  `json:"period_start"` // 周期第一天 YYYY-MM-DD
+	Progress    int64   `json:"progress"`     // 与 metric 同单位
+	Percent     float64 `json:"percent"`      // 0~100，超过目标时封顶 100
+	Met         bool    `json:"met"`
+}
+
+// goalPeriod 目标在 t 所在周期的 [start, end)
+func goalPeriod(g models.Goal, t time.Time, loc *time.Location) (time.Time, time.Time) {
+	if g.Period == "weekly" {
+		start := weekStart(t, loc)
+		return start, addDays(start, 7)
+	}
+	start := dayStart(t, loc)
+	return start, addDays(start, 1)
+}
+
+// goalProgressAt 计算目标在 t 所在周期的进度（按 end_at 归属，与其它统计一致）
+func goalProgressAt(db *gorm.DB, o owner, g models.Goal, t time.Time, loc *time.Location) goalProgress {
+	start, end := goalPeriod(g, t, loc)
+	q := db.Model(&models.Session{}).Scopes(o.scope).
+		Where("status='finished' AND end_at >= ? AND end_at < ?", start, end)
+	var n int64
+	if g.Metric == "pomodoros" {
+		q.Where("mode IN ('pomodoro','countdown') AND duration_sec >= planned_minutes * 60").Count(&n)
+	} else {
+		q.Select("COALESCE(SUM(duration_sec), 0) / 60").Scan(&n)
+	}
+	p := goalProgress{Goal: g, PeriodStart: start.Format("2006-01-02"), Progress: n}
+	if g.Target > 0 {
+		p.Percent = min(float64(n)*100/float64(g.Target), 100)
+	}
+	p.Met = n >= int64(g.Target)
+	return p
+}
+
+// checkGoals 会话在 at 结束后检查归属者的启用中的目标，本周期刚达成的写一条 goal_met 成长事件
+// 每个目标每个周期只发一次（部分唯一索引 uniq_growth_goal_met 兜底并发）；之后修改/删除会话让进度回落也不撤回
+func checkGoals(tx *gorm.DB, sess models.Session, at time.Time) error {
+	o := sessionOwner(sess)
+	var goals []models.Goal
+	if err := tx.Scopes(o.scope).Where("active=true").Find(&goals).Error; err != nil {
+		return err
+	}
+	if len(goals) == 0 {
+		return nil
+	}
+	loc, err := time.LoadLocation(ownerTimezone(tx, o))
+	if err != nil {
+		return err
+	}
+	for _, g := range goals {
+		p := goalProgressAt(tx, o, g, at, loc)
+		if !p.Met {
+			continue
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.GrowthEvent{
+			VisitorID: sess.VisitorID,
+			UserID:    sess.UserID,
+			Type:      models.GrowthGoalMet,
+			SessionID: sess.ID,
+			RefID:     &g.ID,
+			Period:    p.PeriodStart,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentGoals 归属者的目标在当前周期的进度；activeOnly 时只取启用中的
+func (f *Focus) currentGoals(o owner, loc *time.Location, activeOnly bool) []goalProgress {
+	q := f.DB.Scopes(o.scope)
+	if activeOnly {
+		q = q.Where("active=true")
+	}
+	var goals []models.Goal
+	q.Order("period ASC, metric ASC").Find(&goals)
+	now := time.Now()
+	res := make([]goalProgress, 0, len(goals))
+	for _, g := range goals {
+		res = append(res, goalProgressAt(f.DB, o, g, now, loc))
+	}
+	return res
+}
+
+// ListGoals GET /api/v1/goals  全部目标（含停用的）及当前周期的进度
+func (f *Focus) ListGoals(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	c.JSON(200, f.currentGoals(o, f.location(c, o), false))
+}
+
+// POST /api/v1/goals、PATCH /api/v1/goals/:id
+type goalReq struct {
+	Period *string `json:"period"` // daily、weekly
+	Metric *string `json:"metric"` // minutes、pomodoros
+	Target *int    `json:"target"`
+	Active *bool   `json:"active"`
+}
+
+var errGoalExists = errors.New("同一周期、同一指标的目标已存在")
+
+// apply 校验请求并把传了的字段合并到 g 上
+func (r goalReq) apply(g *models.Goal) error {
+	if r.Period != nil {
+		if *r.Period != "daily" && *r.Period != "weekly" {
+			return badRequest("period 只支持 daily、weekly")
+		}
+		g.Period = *r.Period
+	}
+	if r.Metric != nil {
+		if *r.Metric != "minutes" && *r.Metric != "pomodoros" {
+			return badRequest("metric 只支持 minutes、pomodoros")
+		}
+		g.Metric = *r.Metric
+	}
+	if r.Target != nil {
+		if *r.Target < 1 || *r.Target > 10080 {
+			return badRequest("target 应在 1~10080 之间")
+		}
+		g.Target = *r.Target
+	}
+	if r.Active != nil {
+		g.Active = *r.Active
+	}
+	return nil
+}
+
+// saveGoal 保存目标；同一周期同一指标已有目标时由部分唯一索引拒绝，映射成 errGoalExists
+func saveGoal(db *gorm.DB, g *models.Goal) error {
+	err := db.Save(g).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errGoalExists
+	}
+	return err
+}
+
+// goalStatus 把目标相关的错误映射成 HTTP 状态码
+func goalStatus(err error) int {
+	var br badRequest
+	switch {
+	case errors.As(err, &br):
+		return 400
+	case errors.Is(err, errGoalExists):
+		return 409
+	default:
+		return 500
+	}
+}
+
+// CreateGoal POST /api/v1/goals  body: {"period":"daily","metric":"minutes","target":120}
+func (f *Focus) CreateGoal(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req goalReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Period == nil || req.Target == nil {
+		c.JSON(400, gin.H{"message": "需要 period 与 target"})
+		return
+	}
+	g := models.Goal{VisitorID: o.VisitorID, UserID: o.UserID, Metric: "minutes", Active: true}
+	err := req.apply(&g)
+	if err == nil {
+		err = saveGoal(f.DB, &g)
+	}
+	if err != nil {
+		c.JSON(goalStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, goalProgressAt(f.DB, o, g, time.Now(), f.location(c, o)))
+}
+
+// UpdateGoal PATCH /api/v1/goals/:id  修改目标值、周期、指标或启用状态
+func (f *Focus) UpdateGoal(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	g, ok := f.findGoal(o, c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"message": "目标不存在"})
+		return
+	}
+	var req goalReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	err := req.apply(&g)
+	if err == nil {
+		err = saveGoal(f.DB, &g)
+	}
+	if err != nil {
+		c.JSON(goalStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, goalProgressAt(f.DB, o, g, time.Now(), f.location(c, o)))
+}
+
+// DeleteGoal DELETE /api/v1/goals/:id  删除目标（已发出的 goal_met 事件保留）
+func (f *Focus) DeleteGoal(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	g, ok := f.findGoal(o, c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"message": "目标不存在"})
+		return
+	}
+	if err := f.DB.Delete(&g).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// findGoal 按路径参数查找该归属者的目标
+func (f *Focus) findGoal(o owner, idStr string) (models.Goal, bool) {
+	var g models.Goal
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return g, false
+	}
+	return g, f.DB.Scopes(o.scope).Where("id=?", id).Take(&g).Error == nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// Heartbeat POST /api/v1/sessions/heartbeat
+// 前端计时期间定时调用（间隔应明显小于 HEARTBEAT_GRACE）；会话已被自动暂停时返回 paused，由前端提示用户继续
+func (f *Focus) Heartbeat(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var sess models.Session
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sess, err = lockMutable(tx, o); err != nil {
+			return err
+		}
+		if sess.Status != models.SessionStarted {
+			return nil
+		}
+		now := time.Now()
+		sess.LastHeartbeatAt = &now
+		return tx.Model(&sess).Update("last_heartbeat_at", &now).Error
+	})
+	if errors.Is(err, errNoActive) {
+		c.JSON(400, gin.H{"message": "专注未开始"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"session_id":        sess.ID,
+		"status":            sess.Status,
+		"auto_paused":       sess.AutoPaused,
+		"last_heartbeat_at": sess.LastHeartbeatAt,
+	})
+}
+
+// pauseStaleSessions 心跳超时的计时中会话自动暂停，片段收口在最后一次心跳
+// 从未发过心跳、开始时也没声明 heartbeat 的会话（老客户端）不处理；倒计时/番茄钟到点由调度器结束，也不处理
+func (f *Focus) pauseStaleSessions(now time.Time) {
+	grace := f.Cfg.HeartbeatGrace
+	if grace <= 0 {
+		return
+	}
+	var stale []models.Session
+	f.DB.Where("status='started' AND mode NOT IN ('countdown','pomodoro') AND last_heartbeat_at < ?", now.Add(-grace)).
+		Find(&stale)
+	for _, s := range stale {
+		if err := f.DB.Transaction(func(tx *gorm.DB) error {
+			var sess models.Session
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id=? AND status='started' AND last_heartbeat_at < ?", s.ID, now.Add(-grace)).
+				Take(&sess).Error; err != nil {
+				return nil // 期间收到了心跳或已被客户端处理
+			}
+			at := lastAlive(tx, sess)
+			if _, err := pauseSession(tx, sess, at); err != nil {
+				return err
+			}
+			if err := recordInterruption(tx, sess.ID, at, models.InterruptionAuto, ""); err != nil {
+				return err
+			}
+			return tx.Model(&sess).Update("auto_paused", true).Error
+		}); err != nil {
+			logSchedulerError("heartbeat pause", s.ID, err)
+		}
+	}
+}
+
+// reapAbandonedSessions 开始超过 SESSION_MAX_AGE 仍是 started/paused 的会话按 SESSION_REAP_ACTION 收口
+// finish 时结束时间取最后一次能确认用户在场的时刻，而不是现在，避免把无人值守的时间计入成长值
+func (f *Focus) reapAbandonedSessions(now time.Time) {
+	maxAge := f.Cfg.SessionMaxAge
+	if maxAge <= 0 {
+		return
+	}
+	var old []models.Session
+	f.DB.Where("status IN ('started','paused') AND start_at < ?", now.Add(-maxAge)).Find(&old)
+	for _, s := range old {
+		if err := f.DB.Transaction(func(tx *gorm.DB) error {
+			var sess models.Session
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id=? AND status IN ('started','paused')", s.ID).Take(&sess).Error; err != nil {
+				return nil
+			}
+			at := lastAlive(tx, sess)
+			if f.Cfg.SessionReapAction == "cancel" {
+				return cancelSession(tx, sess, at)
+			}
+			if err := closeSession(tx, sess, at); err != nil {
+				return err
+			}
+			// 番茄钟的工作阶段结束后会进入休息，被收口时整轮一起结束
+			if sess.CycleID != nil {
+				return stopCycle(tx, *sess.CycleID, at)
+			}
+			return nil
+		}); err != nil {
+			logSchedulerError("session reap", s.ID, err)
+		}
+	}
+}
+
+// lastAlive 最后一次能确认用户在场的时刻：
+// 已暂停的取最后一个片段的结束；计时中的取最后一次心跳与当前片段开始中较晚的一个
+func lastAlive(tx *gorm.DB, sess models.Session) time.Time {
+	var last models.Segment
+	if tx.Where("session_id=?", sess.ID).Order("start_at DESC").Take(&last).Error != nil {
+		return sess.StartAt
+	}
+	if last.EndAt != nil {
+		return *last.EndAt
+	}
+	at := last.StartAt
+	if sess.LastHeartbeatAt != nil && sess.LastHeartbeatAt.After(at) {
+		at = *sess.LastHeartbeatAt
+	}
+	return at
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// heatmapDay 热力图里的一天
+type heatmapDay struct {
+	Date    string `json:"date"`
+	Minutes int64  `json:"minutes"`
+	Level   int    `json:"level"` // 0 表示没有专注，1~4 按用户自己当年的分布（四分位数）划分
+}
+
+// Heatmap GET /api/v1/stats/heatmap?year=2025
+// 返回一整年（365 或 366 天）每天的专注分钟与强度等级，日期按用户时区切分
+// 跨过 0 点的会话按片段的实际起止拆到各自的日期上，而不是整条算在结束那天
+func (f *Focus) Heatmap(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	loc := f.location(c, o)
+	year := time.Now().In(loc).Year()
+	if s := c.Query("year"); s != "" {
+		y, err := strconv.Atoi(s)
+		if err != nil || y < 2000 || y > 9999 {
+			c.JSON(400, gin.H{"message": "year 不合法"})
+			return
+		}
+		year = y
+	}
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	to := time.Date(year+1, 1, 1, 0, 0, 0, 0, loc)
+
+	// 每个片段与它覆盖的每个当地日期求交集；d 是当地时间的 0 点，d AT TIME ZONE tz 换回绝对时间，夏令时也不会错位
+	type row struct {
+		Day     time.Time
+		Seconds int64
+	}
+	var rows []row
+	f.DB.Table("segments seg").
+		Joins("JOIN sessions s ON s.id = seg.session_id AND s.deleted_at IS NULL").
+		Joins(`CROSS JOIN LATERAL generate_series(
+			date_trunc('day', seg.start_at AT TIME ZONE ?),
+			date_trunc('day', seg.end_at AT TIME ZONE ?),
+			interval '1 day') AS d`, loc.String(), loc.String()).
+		Select(`d::date AS day, SUM(EXTRACT(EPOCH FROM
+			LEAST(seg.end_at, (d + interval '1 day') AT TIME ZONE ?) - GREATEST(seg.start_at, d AT TIME ZONE ?)))::bigint AS seconds`,
+			loc.String(), loc.String()).
+		Scopes(o.scope).
+		Where("s.status = ? AND seg.end_at IS NOT NULL AND seg.end_at > ? AND seg.start_at < ?",
+			models.SessionFinished, from, to).
+		Group("day").Scan(&rows)
+
+	secs := map[string]int64{}
+	var nonzero []int64
+	for _, r := range rows {
+		d := r.Day.Format("2006-01-02")
+		if r.Seconds <= 0 || d < from.Format("2006-01-02") || d >= to.Format("2006-01-02") {
+			continue
+		}
+		secs[d] = r.Seconds
+		nonzero = append(nonzero, r.Seconds)
+	}
+	thresholds := quartiles(nonzero)
+
+	days := make([]heatmapDay, 0, 366)
+	var total int64
+	for d := from; d.Before(to); d = addDays(d, 1) {
+		key := d.Format("2006-01-02")
+		s := secs[key]
+		total += s
+		days = append(days, heatmapDay{Date: key, Minutes: s / 60, Level: heatLevel(s, thresholds)})
+	}
+	c.JSON(200, gin.H{
+		"year":          year,
+		"timezone":      loc.String(),
+		"total_minutes": total / 60,
+		"active_days":   len(nonzero),
+		"days":          days,
+	})
+}
+
+// quartiles 非零值的 25/50/75 分位数（最近秩法），没有数据时返回 nil
+func quartiles(vals []int64) []int64 {
+	if len(vals) == 0 {
+		return nil
+	}
+	sorted := append([]int64(nil), vals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	q := make([]int64, 3)
+	for i, p := range []float64{0.25, 0.5, 0.75} {
+		idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+		q[i] = sorted[max(idx, 0)]
+	}
+	return q
+}
+
+// heatLevel 按分位数划分强度：<=Q1 为 1，<=Q2 为 2，<=Q3 为 3，其余为 4
+func heatLevel(sec int64, q []int64) int {
+	if sec <= 0 {
+		return 0
+	}
+	for i, t := range q {
+		if sec <= t {
+			return i + 1
+		}
+	}
+	return 4
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// historyCursor 游标分页的位置：上一页最后一条的排序值 + id（排序值相同时用 id 兜底）
+type historyCursor struct {
+	StartAt  *time.Time `json:"t,omitempty"`
+	Duration *int64     `json:"d,omitempty"`
+	ID       uint       `json:"id"`
+}
+
+func (hc historyCursor) encode() string {
+	b, _ := json.Marshal(hc)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (historyCursor, bool) {
+	var hc historyCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &hc) != nil || hc.ID == 0 {
+		return hc, false
+	}
+	return hc, true
+}
+
+// ListSessions GET /api/v1/sessions
+// 历史会话列表，游标分页：?limit=20&cursor=<上一页的 next_cursor>
+// 过滤：status、mode、task_id、tag（标签 ID）、from/to（按开始日期，YYYY-MM-DD，含当天，按用户时区）
+// 排序：sort=start_at|duration_sec，order=desc|asc（默认按开始时间倒序）
+func (f *Focus) ListSessions(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	limit := 20
+	if s := c.Query("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	sortCol := c.DefaultQuery("sort", "start_at")
+	if sortCol != "start_at" && sortCol != "duration_sec" {
+		c.JSON(400, gin.H{"message": "sort 只支持 start_at、duration_sec"})
+		return
+	}
+	desc := c.DefaultQuery("order", "desc") != "asc"
+
+	loc := f.location(c, o)
+	q := f.DB.Scopes(o.scope)
+	if s := c.Query("status"); s != "" {
+		q = q.Where("status=?", s)
+	}
+	if s := c.Query("mode"); s != "" {
+		q = q.Where("mode=?", s)
+	}
+	if s := c.Query("task_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"message": "task_id 应为数字"})
+			return
+		}
+		q = q.Where("task_id=?", id)
+	}
+	if s := c.Query("tag"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"message": "tag 应为标签 ID"})
+			return
+		}
+		q = q.Where("id IN (SELECT session_id FROM session_tags WHERE tag_id=?)", id)
+	}
+	if s := c.Query("from"); s != "" {
+		d, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			c.JSON(400, gin.H{"message": "from 格式应为 YYYY-MM-DD"})
+			return
+		}
+		q = q.Where("start_at >= ?", d)
+	}
+	if s := c.Query("to"); s != "" {
+		d, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			c.JSON(400, gin.H{"message": "to 格式应为 YYYY-MM-DD"})
+			return
+		}
+		q = q.Where("start_at < ?", addDays(d, 1))
+	}
+
+	// 游标条件：(排序值, id) 严格在上一页最后一条之后
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+	if s := c.Query("cursor"); s != "" {
+		hc, ok := decodeCursor(s)
+		if !ok {
+			c.JSON(400, gin.H{"message": "无效的cursor"})
+			return
+		}
+		var v any
+		switch {
+		case sortCol == "start_at" && hc.StartAt != nil:
+			v = *hc.StartAt
+		case sortCol == "duration_sec" && hc.Duration != nil:
+			v = *hc.Duration
+		default:
+			c.JSON(400, gin.H{"message": "cursor 与 sort 不匹配"})
+			return
+		}
+		q = q.Where("("+sortCol+" "+cmp+" ?) OR ("+sortCol+" = ? AND id "+cmp+" ?)", v, v, hc.ID)
+	}
+
+	var list []models.Session
+	if err := q.Preload("Tags").Order(sortCol + " " + dir).Order("id " + dir).
+		Limit(limit + 1).Find(&list).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+
+	var next *string
+	if len(list) > limit {
+		list = list[:limit]
+		last := list[limit-1]
+		hc := historyCursor{ID: last.ID}
+		if sortCol == "start_at" {
+			hc.StartAt = &last.StartAt
+		} else {
+			hc.Duration = &last.DurationSec
+		}
+		s := hc.encode()
+		next = &s
+	}
+	c.JSON(200, gin.H{
+		"items":       list,
+		"next_cursor": next,
+	})
+}
+
+// GetSession GET /api/v1/sessions/:id
+// 返回会话详情与完整的片段时间线；focused_sec 为片段累计，paused_sec 为片段之间的暂停间隔
+// interruptions 为每次暂停的中断记录，interruption_breakdown 按原因计数
+func (f *Focus) GetSession(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(404, gin.H{"message": "会话不存在"})
+		return
+	}
+	var sess models.Session
+	err = f.DB.Scopes(o.scope).
+		Preload("Segments", func(db *gorm.DB) *gorm.DB { return db.Order("start_at ASC") }).
+		Preload("Tags").
+		Preload("Interruptions", func(db *gorm.DB) *gorm.DB { return db.Order("at ASC") }).
+		Where("id=?", id).Take(&sess).Error
+	if err != nil {
+		c.JSON(404, gin.H{"message": "会话不存在"})
+		return
+	}
+
+	now := time.Now()
+	var focused, paused int64
+	for i, sg := range sess.Segments {
+		end := now
+		if sg.EndAt != nil {
+			end = *sg.EndAt
+		}
+		focused += int64(end.Sub(sg.StartAt).Seconds())
+		if i > 0 && sess.Segments[i-1].EndAt != nil {
+			paused += int64(sg.StartAt.Sub(*sess.Segments[i-1].EndAt).Seconds())
+		}
+	}
+	c.JSON(200, gin.H{
+		"session":     sess,
+		"focused_sec": focused,
+		"paused_sec":  paused,
+
+		"interruption_count":     len(sess.Interruptions),
+		"interruption_breakdown": interruptionBreakdown(sess.Interruptions),
+	})
+}
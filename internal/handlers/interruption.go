@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// recordInterruption 为刚刚在 at 时刻暂停的会话记一条中断，关联被收口的那个片段
+func recordInterruption(tx *gorm.DB, sessionID uint, at time.Time, reason, note string) error {
+	var seg models.Segment
+	if err := tx.Where("session_id=?", sessionID).Order("start_at DESC").Take(&seg).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.Interruption{
+		SessionID: sessionID,
+		SegmentID: seg.ID,
+		Reason:    reason,
+		Note:      note,
+		At:        at,
+	}).Error
+}
+
+// interruptionBreakdown 按原因统计中断次数
+func interruptionBreakdown(list []models.Interruption) map[string]int {
+	m := map[string]int{}
+	for _, it := range list {
+		m[it.Reason]++
+	}
+	return m
+}
+
+// reasonCount 中断原因的统计行
+type reasonCount struct {
+	Reason string  `json:"reason"`
+	Count  int64   `json:"count"`
+	Share  float64 `json:"share"` // 占全部中断的比例，0~1
+}
+
+// InterruptionStats GET /api/v1/stats/interruptions?from=&to=
+// 区间内已完成会话（按 end_at 归属日期，与其它统计一致）的中断分析：
+// 按原因从多到少排列，以及每专注 1 小时被打断几次
+func (f *Focus) InterruptionStats(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	from, to, err := parseDateRange(c, f.location(c, o))
+	if err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	finished := func() *gorm.DB {
+		return f.DB.Model(&models.Session{}).Scopes(o.scope).
+			Where("status='finished' AND end_at >= ? AND end_at < ?", from, to)
+	}
+
+	var focusedSec int64
+	finished().Select("COALESCE(SUM(duration_sec), 0)").Scan(&focusedSec)
+
+	var rows []reasonCount
+	f.DB.Model(&models.Interruption{}).
+		Select("reason, COUNT(*) AS count").
+		Where("session_id IN (?)", finished().Select("id")).
+		Group("reason").Order("count DESC, reason ASC").Scan(&rows)
+
+	var total int64
+	for _, r := range rows {
+		total += r.Count
+	}
+	for i := range rows {
+		rows[i].Share = float64(rows[i].Count) / float64(total)
+	}
+	perHour := 0.0
+	if focusedSec > 0 {
+		perHour = float64(total) / (float64(focusedSec) / 3600)
+	}
+	var top *string
+	if len(rows) > 0 {
+		top = &rows[0].Reason
+	}
+	c.JSON(200, gin.H{
+		"from":               from.Format("2006-01-02"),
+		"to":                 addDays(to, -1).Format("2006-01-02"),
+		"total":              total,
+		"focused_minutes":    focusedSec / 60,
+		"per_hour":           perHour,
+		"most_common_reason": top,
+		"reasons":            rows,
+	})
+}
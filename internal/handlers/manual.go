@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+var (
+	errOverlap         = errors.New("与已有的专注时间重叠")
+	errSessionNotFound = errors.New("会话不存在")
+)
+
+// POST /api/v1/sessions/manual、PATCH /api/v1/sessions/:id
+// 时间为 RFC3339 格式，例如 2025-01-01T09:00:00+08:00
+type manualReq struct {
+	StartAt  *time.Time `json:"start_at"`
+	EndAt    *time.Time `json:"end_at"`
+	TaskID   *uint      `json:"task_id"`
+	TaskName *string    `json:"task_name"`
+	Tags     *[]string  `json:"tags"`
+}
+
+// validRange 补录/修改的时间段：至少 1 分钟、不晚于现在、不超过 24 小时
+func validRange(start, end time.Time) error {
+	if !end.After(start) {
+		return badRequest("结束时间必须晚于开始时间")
+	}
+	if end.After(time.Now().Add(time.Minute)) {
+		return badRequest("不能补录未来的专注")
+	}
+	if end.Sub(start) > 24*time.Hour {
+		return badRequest("单次专注不能超过 24 小时")
+	}
+	if end.Sub(start) < time.Minute {
+		return errTooShort
+	}
+	return nil
+}
+
+// ManualSession 补录一次离线专注（例如在考场里），直接记为已完成并产生成长事件
+func (f *Focus) ManualSession(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req manualReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.StartAt == nil || req.EndAt == nil {
+		c.JSON(400, gin.H{"message": "需要 start_at 与 end_at"})
+		return
+	}
+	start, end := req.StartAt.UTC(), req.EndAt.UTC()
+	if err := validRange(start, end); err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	var sess models.Session
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		if hit, err := overlaps(tx, o, 0, start, end); err != nil {
+			return err
+		} else if hit {
+			return errOverlap
+		}
+		taskName, err := f.resolveTask(tx, o, req.TaskID, req.TaskName)
+		if err != nil {
+			return err
+		}
+		var tags []models.Tag
+		if req.Tags != nil {
+			if tags, err = resolveTags(tx, o, *req.Tags); err != nil {
+				return err
+			}
+		}
+		total := int64(end.Sub(start).Seconds())
+		sess = models.Session{
+			VisitorID:   o.VisitorID,
+			UserID:      o.UserID,
+			Mode:        "manual",
+			TaskName:    taskName,
+			TaskID:      req.TaskID,
+			Tags:        tags,
+			Status:      "finished",
+			StartAt:     start,
+			EndAt:       &end,
+			DurationSec: total,
+		}
+		if err := tx.Create(&sess).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Segment{SessionID: sess.ID, StartAt: start, EndAt: &end}).Error; err != nil {
+			return err
+		}
+		_, err = creditFinished(tx, sess, total, end)
+		return err
+	})
+	if err != nil {
+		c.JSON(manualStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, sess)
+}
+
+// EditSession PATCH /api/v1/sessions/:id
+// 修改已完成的会话：调整起止时间、任务或标签
+// 起止时间变化时按新区间裁剪片段（区间外的片段删除，首尾片段延伸到新的起止点），
+// 再按新的总秒数与已计入的分钟数之差补一条成长事件（可能为负数）
+func (f *Focus) EditSession(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req manualReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	var sess models.Session
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sess, err = lockOwnedSession(tx, o, c.Param("id")); err != nil {
+			return err
+		}
+		if sess.Status != "finished" {
+			return badRequest("只能修改已完成的专注")
+		}
+		if req.TaskID != nil || req.TaskName != nil {
+			_, taskName, err := lookupTask(tx, o, req.TaskID, req.TaskName)
+			if err != nil {
+				return err
+			}
+			// 只传 task_name 时保留原来关联的任务
+			updates := map[string]any{"task_name": taskName}
+			if req.TaskID != nil {
+				updates["task_id"] = req.TaskID
+			}
+			if err := tx.Model(&sess).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if req.Tags != nil {
+			tags, err := resolveTags(tx, o, *req.Tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&sess).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
+		}
+		if req.StartAt == nil && req.EndAt == nil {
+			return nil
+		}
+		start, end := sess.StartAt, *sess.EndAt
+		if req.StartAt != nil {
+			start = req.StartAt.UTC()
+		}
+		if req.EndAt != nil {
+			end = req.EndAt.UTC()
+		}
+		if err := validRange(start, end); err != nil {
+			return err
+		}
+		if hit, err := overlaps(tx, o, sess.ID, start, end); err != nil {
+			return err
+		} else if hit {
+			return errOverlap
+		}
+		total, err := reshapeSegments(tx, sess.ID, start, end)
+		if err != nil {
+			return err
+		}
+		// 区间内保留了原来的暂停间隔，实际专注可能不足 1 分钟；返回错误让事务回滚
+		if total < 60 {
+			return errTooShort
+		}
+		oldEnd := *sess.EndAt
+		if err := tx.Model(&sess).Updates(map[string]any{
+			"start_at": start, "end_at": &end, "duration_sec": total,
+		}).Error; err != nil {
+			return err
+		}
+		if err := adjustCredit(tx, sess, creditedMinutes(total)); err != nil {
+			return err
+		}
+		// 结束时间可能跨天移动，新旧两天的日汇总都要刷新
+		if err := refreshRollup(tx, o, oldEnd, end); err != nil {
+			return err
+		}
+		return reevaluateAfterEdit(tx, sess, end)
+	})
+	if err != nil {
+		c.JSON(manualStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	f.DB.Preload("Segments").Preload("Tags").First(&sess, sess.ID)
+	c.JSON(200, sess)
+}
+
+// DeleteSession DELETE /api/v1/sessions/:id
+// 删除已完成或已取消的会话（软删除），已计入的分钟数用一条负数成长事件冲回
+func (f *Focus) DeleteSession(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		sess, err := lockOwnedSession(tx, o, c.Param("id"))
+		if err != nil {
+			return err
+		}
+		if sess.Status != "finished" && sess.Status != "canceled" {
+			return badRequest("进行中的专注请先结束或取消")
+		}
+		if err := adjustCredit(tx, sess, 0); err != nil {
+			return err
+		}
+		if err := tx.Delete(&sess).Error; err != nil {
+			return err
+		}
+		if sess.EndAt == nil {
+			return nil
+		}
+		if err := refreshRollup(tx, o, *sess.EndAt); err != nil {
+			return err
+		}
+		return reevaluateAfterEdit(tx, sess, *sess.EndAt)
+	})
+	if err != nil {
+		c.JSON(manualStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// reevaluateAfterEdit 会话被修改或删除后，按 at 所在周期重新检查目标，并全量重算成就进度
+// 修改可能让目标或成就新达成；回落的不撤回
+func reevaluateAfterEdit(tx *gorm.DB, sess models.Session, at time.Time) error {
+	if err := checkGoals(tx, sess, at); err != nil {
+		return err
+	}
+	return onAchievementEvent(tx, sessionOwner(sess), sess.ID, at)
+}
+
+// badRequest 参数校验类错误，返回 400
+type badRequest string
+
+func (e badRequest) Error() string { return string(e) }
+
+// manualStatus 把补录/修改时的错误映射成 HTTP 状态码
+func manualStatus(err error) int {
+	var br badRequest
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		return 404
+	case errors.Is(err, errOverlap):
+		return 409
+	case errors.As(err, &br), errors.Is(err, errTooShort), errors.Is(err, errTaskNotFound):
+		return 400
+	default:
+		return 500
+	}
+}
+
+// lockOwnedSession 按路径参数锁住该归属者的一条会话
+func lockOwnedSession(tx *gorm.DB, o owner, idStr string) (models.Session, error) {
+	var sess models.Session
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return sess, errSessionNotFound
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(o.scope).
+		Where("id=?", id).Take(&sess).Error; err != nil {
+		return sess, errSessionNotFound
+	}
+	return sess, nil
+}
+
+// overlaps 判断 [start, end) 是否与该归属者的其它会话重叠（已取消的不算，进行中的算到现在）
+// 检查前先拿该归属者的事务级咨询锁，并发补录同一时间段时后到的一方等前者提交后再检查
+func overlaps(tx *gorm.DB, o owner, excludeID uint, start, end time.Time) (bool, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", o.key()).Error; err != nil {
+		return false, err
+	}
+	var n int64
+	err := tx.Model(&models.Session{}).Scopes(o.scope).
+		Where("id<>? AND status<>'canceled' AND start_at < ? AND COALESCE(end_at, now()) > ?", excludeID, end, start).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// reshapeSegments 把会话的片段裁剪到 [start, end]：区间外的删掉，跨边界的截断，
+// 第一个片段的开始与最后一个片段的结束对齐到新的起止点；返回新的总秒数
+func reshapeSegments(tx *gorm.DB, sessionID uint, start, end time.Time) (int64, error) {
+	var segs []models.Segment
+	if err := tx.Where("session_id=?", sessionID).Order("start_at ASC").Find(&segs).Error; err != nil {
+		return 0, err
+	}
+	kept := make([]models.Segment, 0, len(segs))
+	for _, sg := range segs {
+		s, e := sg.StartAt, end
+		if sg.EndAt != nil {
+			e = *sg.EndAt
+		}
+		s, e = maxTime(s, start), minTime(e, end)
+		if !e.After(s) {
+			if err := tx.Delete(&sg).Error; err != nil {
+				return 0, err
+			}
+			continue
+		}
+		sg.StartAt, sg.EndAt = s, &e
+		kept = append(kept, sg)
+	}
+	if len(kept) == 0 {
+		kept = append(kept, models.Segment{SessionID: sessionID})
+	}
+	kept[0].StartAt = start
+	last := end
+	kept[len(kept)-1].EndAt = &last
+
+	var total int64
+	for i := range kept {
+		if err := tx.Save(&kept[i]).Error; err != nil {
+			return 0, err
+		}
+		total += int64(kept[i].EndAt.Sub(kept[i].StartAt).Seconds())
+	}
+	return total, nil
+}
+
+// adjustCredit 让会话已计入的分钟数等于 want：差额写成一条补偿成长事件（可能为负数）
+func adjustCredit(tx *gorm.DB, sess models.Session, want int) error {
+	var have int
+	if err := tx.Model(&models.GrowthEvent{}).Where("session_id=? AND type=?", sess.ID, models.GrowthFocus).
+		Select("COALESCE(SUM(minutes), 0)").Scan(&have).Error; err != nil {
+		return err
+	}
+	if want == have {
+		return nil
+	}
+	return tx.Create(&models.GrowthEvent{
+		VisitorID: sess.VisitorID,
+		UserID:    sess.UserID,
+		Type:      models.GrowthFocus,
+		SessionID: sess.ID,
+		Minutes:   want - have,
+	}).Error
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// mergeResult 游客数据合并到账号的结果
+type mergeResult struct {
+	Sessions     int64  `json:"sessions"`      // 转移的会话数（片段跟随会话一起转移）
+	GrowthEvents int64  `json:"growth_events"` // 转移的成长事件数
+	Closed       []uint `json:"closed"`        // 因双方都有进行中的会话而被收口的会话 ID
+}
+
+// mergeGuest 把游客（visitor_id 且未归属账号）的会话、成长事件、番茄钟、任务、目标、标签、设置与已解锁的成就转移到注册用户名下
+// 整个过程在一个事务内完成；已转移的数据 user_id 不再为空，重复调用不会产生变化（幂等）
+// 如果游客与账号两边都有 started/paused 的会话，只保留最近开始的那一个，
+// 其余的按 Finish 逻辑收口（不足 1 分钟则取消），保证合并后仍只有一个可变更的会话
+func mergeGuest(db *gorm.DB, visitorID string, userID uint) (mergeResult, error) {
+	var res mergeResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		guest := owner{VisitorID: visitorID}
+
+		// 锁住双方进行中的会话，避免合并期间被并发修改
+		var active []models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status IN ('started','paused') AND ((visitor_id=? AND user_id IS NULL) OR user_id=?)",
+				visitorID, userID).
+			Order("start_at DESC").Find(&active).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for i, s := range active {
+			if i == 0 {
+				continue // 最近开始的会话保留
+			}
+			if err := closeSession(tx, s, now); err != nil {
+				return err
+			}
+			res.Closed = append(res.Closed, s.ID)
+		}
+
+		// 已软删除的会话/任务/目标也一起转移，否则之后同步同一 client_ref 时找不到而被重新建出来
+		r := tx.Unscoped().Model(&models.Session{}).Scopes(guest.scope).Update("user_id", userID)
+		if r.Error != nil {
+			return r.Error
+		}
+		res.Sessions = r.RowsAffected
+		r = tx.Model(&models.GrowthEvent{}).Scopes(guest.scope).Update("user_id", userID)
+		if r.Error != nil {
+			return r.Error
+		}
+		res.GrowthEvents = r.RowsAffected
+		if err := tx.Model(&models.PomodoroCycle{}).Scopes(guest.scope).Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Task{}).Scopes(guest.scope).Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		// 账号已有同一周期同一指标的目标时以账号的为准，游客的删掉
+		if err := tx.Scopes(guest.scope).
+			Where("EXISTS (SELECT 1 FROM goals u WHERE u.user_id=? AND u.period=goals.period AND u.metric=goals.metric AND u.deleted_at IS NULL)", userID).
+			Delete(&models.Goal{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Goal{}).Scopes(guest.scope).Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		if err := mergePreference(tx, guest, userID); err != nil {
+			return err
+		}
+		if err := mergeTags(tx, guest, userID); err != nil {
+			return err
+		}
+		// 会话换了归属者：游客的日汇总作废，账号的按合并后的会话重建
+		if err := tx.Where("owner_key=?", guest.key()).Delete(&models.DailyStat{}).Error; err != nil {
+			return err
+		}
+		user := owner{VisitorID: visitorID, UserID: &userID}
+		if err := refreshRollup(tx, user); err != nil {
+			return err
+		}
+		// 成就进度同理：丢掉游客的，按合并后的数据重新评估账号的
+		if err := tx.Where("owner_key=?", guest.key()).Delete(&models.AchievementProgress{}).Error; err != nil {
+			return err
+		}
+		if err := mergeAchievements(tx, guest, user); err != nil {
+			return err
+		}
+		return onAchievementEvent(tx, user, 0, now)
+	})
+	return res, err
+}
+
+// mergeAchievements 游客已解锁的成就转给账号；两边都解锁过的保留较早的那次
+func mergeAchievements(tx *gorm.DB, guest, user owner) error {
+	if err := tx.Exec(`UPDATE user_achievements u SET unlocked_at=g.unlocked_at, session_id=g.session_id
+		FROM user_achievements g
+		WHERE u.owner_key=? AND g.owner_key=? AND g.achievement_id=u.achievement_id AND g.unlocked_at < u.unlocked_at`,
+		user.key(), guest.key()).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`DELETE FROM user_achievements g WHERE g.owner_key=? AND EXISTS
+		(SELECT 1 FROM user_achievements u WHERE u.owner_key=? AND u.achievement_id=g.achievement_id)`,
+		guest.key(), user.key()).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.UserAchievement{}).Where("owner_key=?", guest.key()).
+		Update("owner_key", user.key()).Error
+}
+
+// closeSession 结束一个进行中的会话：满 1 分钟按 Finish 计入，否则直接取消
+func closeSession(tx *gorm.DB, s models.Session, at time.Time) error {
+	_, _, err := finishSession(tx, s, at)
+	if !errors.Is(err, errTooShort) {
+		return err
+	}
+	return cancelSession(tx, s, at)
+}
+
+// mergeTags 转移游客的标签；账号下已有同名标签时把会话关联改指过去，再删掉游客的那个
+func mergeTags(tx *gorm.DB, guest owner, userID uint) error {
+	var tags []models.Tag
+	if err := tx.Scopes(guest.scope).Find(&tags).Error; err != nil {
+		return err
+	}
+	for _, t := range tags {
+		var dup models.Tag
+		if tx.Where("user_id=? AND lower(name)=lower(?)", userID, t.Name).Take(&dup).Error != nil {
+			if err := tx.Model(&t).Update("user_id", userID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		// 同一会话两个标签都有时先删掉会重复的关联
+		if err := tx.Exec(`DELETE FROM session_tags WHERE tag_id=? AND session_id IN
+			(SELECT session_id FROM session_tags WHERE tag_id=?)`, t.ID, dup.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE session_tags SET tag_id=? WHERE tag_id=?", dup.ID, t.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&t).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergePreference 账号还没有设置时沿用游客的，否则以账号的为准
+func mergePreference(tx *gorm.DB, guest owner, userID uint) error {
+	var n int64
+	if err := tx.Model(&models.Preference{}).Where("user_id=?", userID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return tx.Scopes(guest.scope).Delete(&models.Preference{}).Error
+	}
+	return tx.Model(&models.Preference{}).Scopes(guest.scope).Update("user_id", userID).Error
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// POST /api/v1/pomodoro/start
+// 不传的字段使用经典配置：4 轮 × 25 分钟工作 / 5 分钟短休息，第 4 轮后 15 分钟长休息
+type pomodoroStartReq struct {
+	WorkMinutes       int     `json:"work_minutes"`
+	ShortBreakMinutes int     `json:"short_break_minutes"`
+	LongBreakMinutes  int     `json:"long_break_minutes"`
+	LongBreakEvery    int     `json:"long_break_every"`
+	Rounds            int     `json:"rounds"`
+	TaskName          *string `json:"task_name"`
+	TaskID            *uint   `json:"task_id"`
+}
+
+// PomodoroStart 开始一整轮番茄钟，并立即进入第 1 轮工作
+// 之后的阶段切换（工作到点 -> 休息 -> 下一轮工作）由后台调度器完成
+func (f *Focus) PomodoroStart(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req pomodoroStartReq
+	_ = c.ShouldBindJSON(&req)
+	if req.WorkMinutes == 0 {
+		req.WorkMinutes = 25
+	}
+	if req.ShortBreakMinutes == 0 {
+		req.ShortBreakMinutes = 5
+	}
+	if req.LongBreakMinutes == 0 {
+		req.LongBreakMinutes = 15
+	}
+	if req.LongBreakEvery == 0 {
+		req.LongBreakEvery = 4
+	}
+	if req.Rounds == 0 {
+		req.Rounds = req.LongBreakEvery
+	}
+	if req.WorkMinutes < 1 || req.WorkMinutes > 180 ||
+		req.ShortBreakMinutes < 1 || req.ShortBreakMinutes > 60 ||
+		req.LongBreakMinutes < 1 || req.LongBreakMinutes > 120 ||
+		req.LongBreakEvery < 1 || req.Rounds < 1 || req.Rounds > 24 {
+		c.JSON(400, gin.H{"message": "番茄钟配置不合法"})
+		return
+	}
+	if _, busy := f.findCycle(o); busy {
+		c.JSON(409, gin.H{"message": "已有正在进行的番茄钟"})
+		return
+	}
+
+	now := time.Now()
+	cy := models.PomodoroCycle{
+		VisitorID:         o.VisitorID,
+		UserID:            o.UserID,
+		WorkMinutes:       req.WorkMinutes,
+		ShortBreakMinutes: req.ShortBreakMinutes,
+		LongBreakMinutes:  req.LongBreakMinutes,
+		LongBreakEvery:    req.LongBreakEvery,
+		Rounds:            req.Rounds,
+		Status:            "running",
+		TaskID:            req.TaskID,
+	}
+	// 任务在事务内转为 doing：开始失败（已有进行中的会话等）时一起回滚
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if cy.TaskName, err = f.resolveTask(tx, o, req.TaskID, req.TaskName); err != nil {
+			return err
+		}
+		if err := tx.Create(&cy).Error; err != nil {
+			return err
+		}
+		return startWork(tx, &cy, now)
+	})
+	if err != nil {
+		c.JSON(lifecycleStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, cy)
+}
+
+// PomodoroCurrent GET /api/v1/pomodoro/current
+// 返回正在进行的番茄钟，以及当前阶段的剩余秒数；没有则返回 null
+func (f *Focus) PomodoroCurrent(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	cy, ok := f.findCycle(o)
+	if !ok {
+		c.JSON(200, nil)
+		return
+	}
+	var remaining int64
+	if cy.Phase == "work" && cy.SessionID != nil {
+		remaining = int64(cy.WorkMinutes)*60 - f.totalSeconds(*cy.SessionID)
+	} else {
+		remaining = int64(breakMinutes(cy)*60) - int64(time.Since(cy.PhaseStartAt).Seconds())
+	}
+	c.JSON(200, gin.H{
+		"cycle":         cy,
+		"remaining_sec": max(remaining, 0),
+	})
+}
+
+// PomodoroSkip POST /api/v1/pomodoro/skip
+// 休息阶段：立即结束休息进入下一轮工作；工作阶段：提前结束本轮工作（同 Finish，至少 1 分钟）
+func (f *Focus) PomodoroSkip(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	cy, ok := f.findCycle(o)
+	if !ok {
+		c.JSON(400, gin.H{"message": "没有正在进行的番茄钟"})
+		return
+	}
+	now := time.Now()
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		if cy.Phase != "work" {
+			return leaveBreak(tx, cy.ID, now)
+		}
+		s, err := lockMutable(tx, o)
+		if err != nil {
+			return err
+		}
+		if s.CycleID == nil || *s.CycleID != cy.ID {
+			return errNoActive
+		}
+		_, _, err = finishSession(tx, s, now)
+		return err
+	})
+	if errors.Is(err, errTooShort) {
+		c.String(400, err.Error())
+		return
+	}
+	if err != nil {
+		c.JSON(lifecycleStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	f.DB.First(&cy, cy.ID)
+	c.JSON(200, cy)
+}
+
+// PomodoroStop POST /api/v1/pomodoro/stop
+// 提前结束整轮番茄钟：工作阶段的会话满 1 分钟照常计入，否则取消
+func (f *Focus) PomodoroStop(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	cy, ok := f.findCycle(o)
+	if !ok {
+		c.JSON(400, gin.H{"message": "没有正在进行的番茄钟"})
+		return
+	}
+	now := time.Now()
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		if s, err := lockMutable(tx, o); err == nil && s.CycleID != nil && *s.CycleID == cy.ID {
+			if err := closeSession(tx, s, now); err != nil {
+				return err
+			}
+		}
+		return stopCycle(tx, cy.ID, now)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	f.DB.First(&cy, cy.ID)
+	c.JSON(200, cy)
+}
+
+// findCycle 查找该归属者正在进行的番茄钟
+func (f *Focus) findCycle(o owner) (models.PomodoroCycle, bool) {
+	var cy models.PomodoroCycle
+	err := f.DB.Scopes(o.scope).Where("status='running'").
+		Order("id DESC").Take(&cy).Error
+	return cy, err == nil
+}
+
+// finishDueBreaks 结束所有已到点的休息，进入下一轮工作（或整轮完成）
+func (f *Focus) finishDueBreaks(now time.Time) {
+	var cycles []models.PomodoroCycle
+	f.DB.Where("status='running' AND phase IN ('short_break','long_break')").Find(&cycles)
+	for _, cy := range cycles {
+		end := cy.PhaseStartAt.Add(time.Duration(breakMinutes(cy)) * time.Minute)
+		if end.After(now) {
+			continue
+		}
+		if err := f.DB.Transaction(func(tx *gorm.DB) error {
+			return leaveBreak(tx, cy.ID, end)
+		}); err != nil {
+			logSchedulerError("pomodoro break", cy.ID, err)
+		}
+	}
+}
+
+// breakMinutes 番茄钟当前休息阶段的时长
+func breakMinutes(cy models.PomodoroCycle) int {
+	if cy.Phase == "long_break" {
+		return cy.LongBreakMinutes
+	}
+	return cy.ShortBreakMinutes
+}
+
+// lockCycle 锁住一个进行中的番茄钟，已结束的返回 false
+func lockCycle(tx *gorm.DB, cycleID uint) (models.PomodoroCycle, bool) {
+	var cy models.PomodoroCycle
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id=? AND status='running'", cycleID).Take(&cy).Error
+	return cy, err == nil
+}
+
+// startWork 在 at 时刻开始下一轮工作：新建一条 pomodoro 模式的会话与片段
+// 归属者已有其它进行中的会话时返回 errActiveExists
+func startWork(tx *gorm.DB, cy *models.PomodoroCycle, at time.Time) error {
+	work := cy.WorkMinutes
+	sess := models.Session{
+		VisitorID:      cy.VisitorID,
+		UserID:         cy.UserID,
+		Mode:           "pomodoro",
+		PlannedMinutes: &work,
+		TaskName:       cy.TaskName,
+		TaskID:         cy.TaskID,
+		CycleID:        &cy.ID,
+		StartAt:        at,
+	}
+	o := owner{VisitorID: cy.VisitorID, UserID: cy.UserID}
+	if err := createSession(tx, o, &sess, StartConflictReject); err != nil {
+		return err
+	}
+	cy.Round++
+	cy.Phase = "work"
+	cy.PhaseStartAt = at
+	cy.SessionID = &sess.ID
+	return tx.Model(cy).Updates(map[string]any{
+		"round":          cy.Round,
+		"phase":          cy.Phase,
+		"phase_start_at": cy.PhaseStartAt,
+		"session_id":     cy.SessionID,
+	}).Error
+}
+
+// enterBreak 工作阶段的会话结束后进入休息：每 LongBreakEvery 轮长休息一次，其余短休息
+func enterBreak(tx *gorm.DB, cycleID uint, workSec int64, at time.Time) error {
+	cy, ok := lockCycle(tx, cycleID)
+	if !ok || cy.Phase != "work" {
+		return nil
+	}
+	kind := "short_break"
+	if cy.Round%cy.LongBreakEvery == 0 || cy.Round >= cy.Rounds {
+		kind = "long_break"
+	}
+	if err := tx.Create(&models.PomodoroBreak{
+		CycleID: cy.ID,
+		Round:   cy.Round,
+		Kind:    kind,
+		StartAt: at,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&cy).Updates(map[string]any{
+		"phase":          kind,
+		"phase_start_at": at,
+		"session_id":     nil,
+		"work_sec":       gorm.Expr("work_sec + ?", workSec),
+	}).Error
+}
+
+// closeBreak 在 at 时刻收口当前未结束的休息，并累加到番茄钟的休息秒数
+func closeBreak(tx *gorm.DB, cy models.PomodoroCycle, at time.Time) error {
+	var br models.PomodoroBreak
+	if err := tx.Where("cycle_id=? AND end_at IS NULL", cy.ID).Take(&br).Error; err != nil {
+		return nil // 没有进行中的休息
+	}
+	sec := max(int64(at.Sub(br.StartAt).Seconds()), 0)
+	if err := tx.Model(&br).Updates(map[string]any{"end_at": &at, "duration_sec": sec}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&cy).Update("break_sec", gorm.Expr("break_sec + ?", sec)).Error
+}
+
+// leaveBreak 在 at 时刻结束休息：最后一轮则整轮完成，否则开始下一轮工作
+// 如果休息期间用户另外开始了专注，番茄钟就此结束，不会出现两个进行中的会话
+func leaveBreak(tx *gorm.DB, cycleID uint, at time.Time) error {
+	cy, ok := lockCycle(tx, cycleID)
+	if !ok || cy.Phase == "work" {
+		return nil
+	}
+	if err := closeBreak(tx, cy, at); err != nil {
+		return err
+	}
+	if cy.Round < cy.Rounds {
+		err := startWork(tx, &cy, at)
+		if !errors.Is(err, errActiveExists) {
+			return err
+		}
+	}
+	return tx.Model(&cy).Update("status", "finished").Error
+}
+
+// stopCycle 提前结束番茄钟：收口进行中的休息；完成过工作阶段记为 finished，否则 canceled
+func stopCycle(tx *gorm.DB, cycleID uint, at time.Time) error {
+	cy, ok := lockCycle(tx, cycleID)
+	if !ok {
+		return nil
+	}
+	if err := closeBreak(tx, cy, at); err != nil {
+		return err
+	}
+	status := "canceled"
+	if cy.WorkSec > 0 {
+		status = "finished"
+	}
+	return tx.Model(&cy).Updates(map[string]any{"status": status, "session_id": nil}).Error
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
+)
+
+// sessionOwner 会话的归属者
+func sessionOwner(s models.Session) owner {
+	return owner{VisitorID: s.VisitorID, UserID: s.UserID}
+}
+
+// ownerTimezone 归属者保存的时区，没有设置时用 DEFAULT_TIMEZONE
+func ownerTimezone(db *gorm.DB, o owner) string {
+	var p models.Preference
+	if db.Scopes(o.scope).Take(&p).Error == nil && p.Timezone != "" {
+		return p.Timezone
+	}
+	return config.DefaultTimezone()
+}
+
+// refreshRollup 按会话表重新计算归属者在 times 所在日期（归属者时区）的日汇总
+// 只重算受影响的几天，整个计算在数据库里完成：INSERT ... SELECT ... GROUP BY ... ON CONFLICT DO UPDATE，
+// 两个事务同时刷新同一天也不会撞主键；已经没有会话的日期再单独删掉
+// times 为空时重建该归属者的全部日汇总
+func refreshRollup(tx *gorm.DB, o owner, times ...time.Time) error {
+	tz := ownerTimezone(tx, o)
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return err
+	}
+	var days []string
+	for _, t := range times {
+		days = append(days, t.In(loc).Format("2006-01-02"))
+	}
+
+	alive := tx.Model(&models.Session{}).Scopes(o.scope).Select("1").
+		Where("status IN ('finished','canceled') AND end_at IS NOT NULL AND (end_at AT TIME ZONE ?)::date = daily_stats.day", tz)
+	del := tx.Where("owner_key=? AND NOT EXISTS (?)", o.key(), alive)
+	src := tx.Model(&models.Session{}).Scopes(o.scope).
+		Select(`?, (end_at AT TIME ZONE ?)::date AS day,
+			COALESCE(SUM(duration_sec) FILTER (WHERE status='finished'), 0),
+			COUNT(*) FILTER (WHERE status='finished'),
+			COUNT(*) FILTER (WHERE status='canceled'), now()`, o.key(), tz).
+		Where("status IN ('finished','canceled') AND end_at IS NOT NULL")
+	if len(times) > 0 {
+		del = del.Where("day IN ?", days)
+		src = src.Where("(end_at AT TIME ZONE ?)::date IN ?", tz, days)
+	}
+	if err := del.Delete(&models.DailyStat{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO daily_stats (owner_key, day, seconds, sessions, canceled, updated_at) ?
+		ON CONFLICT (owner_key, day) DO UPDATE SET seconds=EXCLUDED.seconds, sessions=EXCLUDED.sessions,
+			canceled=EXCLUDED.canceled, updated_at=EXCLUDED.updated_at`,
+		src.Group("day")).Error
+}
+
+// dayTotal 某一天的汇总
+type dayTotal struct {
+	Seconds  int64
+	Sessions int64
+	Canceled int64
+}
+
+// dailyTotals 归属者在 [from, to) 内按 loc 时区每天的汇总，key 为 YYYY-MM-DD
+// loc 与归属者保存的时区一致时直接读日汇总表，否则（本次请求用 ?tz= 覆盖了时区）在会话表上按 loc 现算
+func (f *Focus) dailyTotals(o owner, loc *time.Location, from, to time.Time) map[string]dayTotal {
+	type row struct {
+		Day      time.Time
+		Seconds  int64
+		Sessions int64
+		Canceled int64
+	}
+	var rows []row
+	if loc.String() == ownerTimezone(f.DB, o) {
+		f.DB.Model(&models.DailyStat{}).Select("day, seconds, sessions, canceled").
+			Where("owner_key=? AND day >= ? AND day < ?", o.key(),
+				from.Format("2006-01-02"), to.Format("2006-01-02")).
+			Scan(&rows)
+	} else {
+		f.DB.Model(&models.Session{}).Scopes(o.scope).
+			Select(`(end_at AT TIME ZONE ?)::date AS day,
+				COALESCE(SUM(duration_sec) FILTER (WHERE status='finished'), 0) AS seconds,
+				COUNT(*) FILTER (WHERE status='finished') AS sessions,
+				COUNT(*) FILTER (WHERE status='canceled') AS canceled`, loc.String()).
+			Where("status IN ('finished','canceled') AND end_at >= ? AND end_at < ?", from, to).
+			Group("day").Scan(&rows)
+	}
+	m := make(map[string]dayTotal, len(rows))
+	for _, r := range rows {
+		m[r.Day.Format("2006-01-02")] = dayTotal{r.Seconds, r.Sessions, r.Canceled}
+	}
+	return m
+}
+
+// totalFocusSeconds 归属者全部已完成会话的总秒数（与时区无关，直接汇总日汇总表）
+func (f *Focus) totalFocusSeconds(o owner) int64 {
+	var total int64
+	f.DB.Model(&models.DailyStat{}).Where("owner_key=?", o.key()).
+		Select("COALESCE(SUM(seconds), 0)").Scan(&total)
+	return total
+}
+
+// EnsureRollups 日汇总表为空而会话表里已有结束的会话时（刚升级到日汇总的库）自动重建一次，返回处理的归属者数
+// 总分钟数、成就等都只读日汇总，不能依赖手工跑 backfill
+func (f *Focus) EnsureRollups() (int, error) {
+	var n int64
+	if err := f.DB.Model(&models.DailyStat{}).Limit(1).Count(&n).Error; err != nil || n > 0 {
+		return 0, err
+	}
+	if err := f.DB.Model(&models.Session{}).Where("status IN ('finished','canceled')").
+		Limit(1).Count(&n).Error; err != nil || n == 0 {
+		return 0, err
+	}
+	return f.RebuildRollups()
+}
+
+// RebuildRollups 为所有有会话的归属者重建日汇总（cmd/backfill 使用），返回处理的归属者数
+func (f *Focus) RebuildRollups() (int, error) {
+	db := f.DB
+	var owners []owner
+	if err := db.Model(&models.Session{}).Distinct("visitor_id", "user_id").
+		Where("user_id IS NULL").Scan(&owners).Error; err != nil {
+		return 0, err
+	}
+	var userIDs []uint
+	if err := db.Model(&models.Session{}).Distinct("user_id").
+		Where("user_id IS NOT NULL").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	for i := range userIDs {
+		owners = append(owners, owner{UserID: &userIDs[i]})
+	}
+	for _, o := range owners {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return refreshRollup(tx, o)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(owners), nil
+}
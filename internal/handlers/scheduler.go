@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// countdownTarget 倒计时（含番茄钟工作阶段）会话的目标秒数；其它会话返回 false
+func countdownTarget(s models.Session) (int64, bool) {
+	if (s.Mode != "countdown" && s.Mode != "pomodoro") || s.PlannedMinutes == nil {
+		return 0, false
+	}
+	return int64(*s.PlannedMinutes) * 60, true
+}
+
+// RunScheduler 服务进程内的后台调度器，每隔 interval 扫描一次：
+// 到点的倒计时/番茄钟工作阶段自动结束，到点的番茄钟休息自动进入下一轮工作，
+// 心跳超时的会话自动暂停，长期无人处理的会话收口
+// 客户端离线时同样会结束并产生成长事件；ctx 取消后退出
+func (f *Focus) RunScheduler(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			f.finishDueCountdowns(now)
+			f.finishDueBreaks(now)
+			f.pauseStaleSessions(now)
+			f.reapAbandonedSessions(now)
+			f.purgeIdempotencyKeys(now)
+		}
+	}
+}
+
+// finishDueCountdowns 结束所有片段累计时长已达到 PlannedMinutes 的倒计时
+func (f *Focus) finishDueCountdowns(now time.Time) {
+	var due []models.Session
+	f.DB.Where("mode IN ('countdown','pomodoro') AND status='started' AND planned_minutes IS NOT NULL").Find(&due)
+	for _, s := range due {
+		if err := f.DB.Transaction(func(tx *gorm.DB) error {
+			return finishCountdown(tx, s.ID, now)
+		}); err != nil {
+			logSchedulerError("countdown finish", s.ID, err)
+		}
+	}
+}
+
+// finishCountdown 锁住会话后复查，到点则按 Finish 的逻辑结束
+// 结束时间取“刚好满 PlannedMinutes”的时刻，而不是扫描到它的时刻，避免多计时长
+func finishCountdown(tx *gorm.DB, sessionID uint, now time.Time) error {
+	var s models.Session
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id=? AND status='started'", sessionID).Take(&s).Error
+	if err != nil {
+		return nil // 已被客户端暂停/结束/取消
+	}
+	target, ok := countdownTarget(s)
+	if !ok {
+		return nil
+	}
+	total := totalSecondsAt(tx, s.ID, now)
+	if total < target {
+		return nil
+	}
+	// 超出的时间只可能发生在当前未结束的片段里，回退到片段开始时刻为止
+	at := now.Add(-time.Duration(total-target) * time.Second)
+	var open models.Segment
+	if tx.Where("session_id=? AND end_at IS NULL", s.ID).Take(&open).Error == nil && at.Before(open.StartAt) {
+		at = open.StartAt
+	}
+	_, _, err = finishSession(tx, s, at)
+	return err
+}
+
+// logSchedulerError 后台任务没有请求可以返回错误，只记日志，下一轮扫描会重试
+func logSchedulerError(job string, id uint, err error) {
+	log.Printf("scheduler %s error: id=%d %v", job, id, err)
+}
+
+// purgeIdempotencyKeys 清理过了重放窗口的幂等响应
+func (f *Focus) purgeIdempotencyKeys(now time.Time) {
+	if err := f.DB.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		logSchedulerError("idempotency purge", 0, err)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+var (
+	errNoActive          = errors.New("没有正在进行的专注")
+	errActiveExists      = errors.New("已有正在进行的专注，请先结束或取消")
+	errIllegalTransition = errors.New("当前状态不允许该操作")
+)
+
+// 开始新会话时已有进行中会话的处理策略（config.StartConflict）
+const (
+	StartConflictReject = "reject" // 拒绝开始，返回 409
+	StartConflictClose  = "close"  // 先按 Finish 逻辑收口旧会话（不足 1 分钟则取消），再开始新的
+)
+
+// lockMutable 在事务内锁住（SELECT ... FOR UPDATE）该归属者可变更的会话
+// 部分唯一索引保证每个归属者最多只有一条 started/paused 会话
+func lockMutable(tx *gorm.DB, o owner) (models.Session, error) {
+	var s models.Session
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(o.scope).
+		Where("status IN ?", []string{models.SessionStarted, models.SessionPaused}).
+		Order("start_at DESC").Take(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s, errNoActive
+	}
+	return s, err
+}
+
+// transition 会话生命周期的一次状态迁移：在一个事务内锁住当前会话，
+// 按 models.SessionTransitions 校验 sess.Status -> to 是否允许，再执行 fn 完成具体的数据修改
+// 并发的两次请求会在行锁上排队，后到的那次看到的已是新状态，从而被拒绝
+func (f *Focus) transition(o owner, to string, fn func(tx *gorm.DB, sess models.Session, now time.Time) error) (models.Session, error) {
+	var sess models.Session
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if sess, err = lockMutable(tx, o); err != nil {
+			return err
+		}
+		if !models.CanTransition(sess.Status, to) {
+			return errIllegalTransition
+		}
+		return fn(tx, sess, time.Now())
+	})
+	return sess, err
+}
+
+// pauseSession 在 at 时刻暂停：结束当前片段，保存累计秒数，改状态为 paused
+func pauseSession(tx *gorm.DB, sess models.Session, at time.Time) (int64, error) {
+	if !models.CanTransition(sess.Status, models.SessionPaused) {
+		return 0, errIllegalTransition
+	}
+	// 结束最后一个未结束的片段（记录片段的结束时间）
+	if err := tx.Model(&models.Segment{}).
+		Where("session_id=? AND end_at IS NULL", sess.ID).
+		Update("end_at", &at).Error; err != nil {
+		return 0, err
+	}
+	// 计算本次会话已用的总秒数并更新会话状态
+	total := totalSecondsAt(tx, sess.ID, at)
+	err := tx.Model(&models.Session{}).Where("id=?", sess.ID).
+		Updates(map[string]any{
+			"status":       models.SessionPaused,
+			"duration_sec": total,
+		}).Error
+	return total, err
+}
+
+// resumeSession 在 at 时刻继续：新建一个片段，改状态为 started
+func resumeSession(tx *gorm.DB, sess models.Session, at time.Time) error {
+	if !models.CanTransition(sess.Status, models.SessionStarted) {
+		return errIllegalTransition
+	}
+	if err := tx.Create(&models.Segment{SessionID: sess.ID, StartAt: at}).Error; err != nil {
+		return err
+	}
+	// 用心跳的客户端从这一刻重新计算心跳超时
+	return tx.Model(&models.Session{}).Where("id=?", sess.ID).
+		Updates(map[string]any{
+			"status":            models.SessionStarted,
+			"auto_paused":       false,
+			"last_heartbeat_at": gorm.Expr("CASE WHEN last_heartbeat_at IS NULL THEN NULL ELSE ?::timestamptz END", at),
+		}).Error
+}
+
+// createSession 在事务内新建一条 started 会话及其第一个片段
+// 已有进行中的会话时按 policy 拒绝或先收口旧会话；并发插入由部分唯一索引兜底（ErrDuplicatedKey）
+func createSession(tx *gorm.DB, o owner, sess *models.Session, policy string) error {
+	cur, err := lockMutable(tx, o)
+	switch {
+	case err == nil && policy == StartConflictClose:
+		if err := closeSession(tx, cur, sess.StartAt); err != nil {
+			return err
+		}
+	case err == nil:
+		return errActiveExists
+	case !errors.Is(err, errNoActive):
+		return err
+	}
+	sess.Status = models.SessionStarted
+	if err := tx.Create(sess).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errActiveExists
+		}
+		return err
+	}
+	return tx.Create(&models.Segment{SessionID: sess.ID, StartAt: sess.StartAt}).Error
+}
+
+// lifecycleStatus 把状态迁移中的错误映射成 HTTP 状态码
+func lifecycleStatus(err error) int {
+	switch {
+	case errors.Is(err, errActiveExists):
+		return 409
+	case errors.Is(err, errNoActive), errors.Is(err, errIllegalTransition),
+		errors.Is(err, errTooShort), errors.Is(err, errTaskNotFound):
+		return 400
+	default:
+		return 500
+	}
+}
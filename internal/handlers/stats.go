@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// parseDateRange 读取 ?from=2006-01-02&to=2006-01-02（均含当天，按 loc 时区的日期）
+// 不传时默认最近 30 天；返回左闭右开的时间区间 [from, to+1天)
+func parseDateRange(c *gin.Context, loc *time.Location) (time.Time, time.Time, error) {
+	today := dayStart(time.Now(), loc)
+	from, to := addDays(today, -29), today
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+			return from, to, errors.New("from 格式应为 YYYY-MM-DD")
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.ParseInLocation("2006-01-02", s, loc); err != nil {
+			return from, to, errors.New("to 格式应为 YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to 不能早于 from")
+	}
+	return from, addDays(to, 1), nil
+}
+
+// tagMinutes 标签维度的统计行
+type tagMinutes struct {
+	TagID    uint   `json:"tag_id"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Minutes  int64  `json:"minutes"`
+	Sessions int64  `json:"sessions"`
+}
+
+// TagStats GET /api/v1/stats/tags?from=&to=
+// 按标签与分类汇总区间内已完成会话的分钟数（按 end_at 归属日期，与 Summary 一致）
+// 一个会话有多个标签时会分别计入每个标签；没有标签的会话计入 untagged_minutes
+func (f *Focus) TagStats(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	from, to, err := parseDateRange(c, f.location(c, o))
+	if err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	// 每次调用都生成新的查询链，避免多次复用同一个 *gorm.DB 时条件互相叠加
+	finished := func() *gorm.DB {
+		return f.DB.Model(&models.Session{}).Scopes(o.scope).
+			Where("status='finished' AND end_at >= ? AND end_at < ?", from, to)
+	}
+
+	var rows []tagMinutes
+	f.DB.Table("session_tags st").
+		Select("t.id AS tag_id, t.name, t.category, SUM(s.duration_sec) / 60 AS minutes, COUNT(*) AS sessions").
+		Joins("JOIN sessions s ON s.id = st.session_id").
+		Joins("JOIN tags t ON t.id = st.tag_id").
+		Where("st.session_id IN (?)", finished().Select("id")).
+		Group("t.id, t.name, t.category").
+		Order("minutes DESC").Scan(&rows)
+
+	// 分类汇总：同一会话在同一分类下有多个标签时只算一次
+	type catMinutes struct {
+		Category string `json:"category"`
+		Minutes  int64  `json:"minutes"`
+	}
+	var cats []catMinutes
+	f.DB.Raw(`SELECT category, SUM(duration_sec) / 60 AS minutes FROM (
+			SELECT DISTINCT s.id, t.category, s.duration_sec
+			FROM session_tags st
+			JOIN sessions s ON s.id = st.session_id
+			JOIN tags t ON t.id = st.tag_id
+			WHERE st.session_id IN (?)
+		) x GROUP BY category ORDER BY minutes DESC`,
+		finished().Select("id")).Scan(&cats)
+
+	var untagged int64
+	finished().
+		Where("NOT EXISTS (SELECT 1 FROM session_tags st WHERE st.session_id = sessions.id)").
+		Select("COALESCE(SUM(duration_sec), 0) / 60").Scan(&untagged)
+
+	c.JSON(200, gin.H{
+		"from":             from.Format("2006-01-02"),
+		"to":               addDays(to, -1).Format("2006-01-02"),
+		"tags":             rows,
+		"categories":       cats,
+		"untagged_minutes": untagged,
+	})
+}
+
+// rangeBucket 区间统计里的一个时间桶
+type rangeBucket struct {
+	Start          string  `json:"start"` // 桶的第一天 YYYY-MM-DD
+	Minutes        int64   `json:"minutes"`
+	Sessions       int64   `json:"sessions"`        // 完成的会话数
+	Canceled       int64   `json:"canceled"`        // 取消的会话数
+	AvgMinutes     float64 `json:"avg_minutes"`     // 完成会话的平均时长
+	CompletionRate float64 `json:"completion_rate"` // 完成 /（完成 + 取消），没有会话时为 0
+
+	seconds int64
+}
+
+// bucketStart 与 nextBucket 按粒度对齐桶的起点、求下一个桶的起点
+func bucketStart(t time.Time, granularity string, loc *time.Location) time.Time {
+	switch granularity {
+	case "week":
+		return weekStart(t, loc)
+	case "month":
+		return monthStart(t, loc)
+	default:
+		return dayStart(t, loc)
+	}
+}
+
+func nextBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case "week":
+		return addDays(t, 7)
+	case "month":
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return addDays(t, 1)
+	}
+}
+
+// RangeStats GET /api/v1/stats/range?from=&to=&granularity=day|week|month
+// 按粒度分桶统计区间内的专注分钟、会话数、平均时长与完成率（按 end_at 在用户时区的日期归属）
+// from/to 会扩展到所在桶的边界（比如按周时从周一开始），没有数据的桶补 0
+func (f *Focus) RangeStats(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	granularity := c.DefaultQuery("granularity", "day")
+	if granularity != "day" && granularity != "week" && granularity != "month" {
+		c.JSON(400, gin.H{"message": "granularity 只支持 day、week、month"})
+		return
+	}
+	loc := f.location(c, o)
+	from, to, err := parseDateRange(c, loc)
+	if err != nil {
+		c.JSON(400, gin.H{"message": err.Error()})
+		return
+	}
+	from = bucketStart(from, granularity, loc)
+	if last := bucketStart(addDays(to, -1), granularity, loc); last.Before(to) {
+		to = nextBucket(last, granularity)
+	}
+
+	var buckets []*rangeBucket
+	index := map[string]*rangeBucket{}
+	for t := from; t.Before(to); t = nextBucket(t, granularity) {
+		if len(buckets) >= 400 {
+			c.JSON(400, gin.H{"message": "区间太长，请缩小范围或改用更粗的粒度"})
+			return
+		}
+		b := &rangeBucket{Start: t.Format("2006-01-02")}
+		buckets = append(buckets, b)
+		index[b.Start] = b
+	}
+
+	// 先取按天的汇总，再在 Go 里并到周/月桶（周、月的边界都落在当地的 0 点上）
+	for day, t := range f.dailyTotals(o, loc, from, to) {
+		d, _ := time.ParseInLocation("2006-01-02", day, loc)
+		b := index[bucketStart(d, granularity, loc).Format("2006-01-02")]
+		if b == nil {
+			continue
+		}
+		b.Sessions += t.Sessions
+		b.Canceled += t.Canceled
+		b.seconds += t.Seconds
+	}
+	for _, b := range buckets {
+		b.Minutes = b.seconds / 60
+		if b.Sessions > 0 {
+			b.AvgMinutes = float64(b.seconds) / 60 / float64(b.Sessions)
+		}
+		if n := b.Sessions + b.Canceled; n > 0 {
+			b.CompletionRate = float64(b.Sessions) / float64(n)
+		}
+	}
+	c.JSON(200, gin.H{
+		"from":        from.Format("2006-01-02"),
+		"to":          addDays(to, -1).Format("2006-01-02"),
+		"granularity": granularity,
+		"timezone":    loc.String(),
+		"buckets":     buckets,
+	})
+}
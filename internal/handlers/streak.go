@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streak 一段连续专注的日子
+type streak struct {
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	Days   int    `json:"days"`   // 达标的天数（用冻结卡补上的日子不算）
+	Frozen int    `json:"frozen"` // 期间用掉的冻结卡
+}
+
+// streakResult 连续专注的统计结果
+type streakResult struct {
+	Current      int      `json:"current"` // 今天还没达标时，截止到昨天的连续天数仍算当前连续
+	Longest      int      `json:"longest"`
+	MinMinutes   int      `json:"min_minutes"`   // 每天至少专注多少分钟才算
+	FreezeTokens int      `json:"freeze_tokens"` // 手里还剩的冻结卡
+	TodayDone    bool     `json:"today_done"`
+	History      []streak `json:"history"` // 由近到远，最多 50 段
+}
+
+// computeStreaks 按用户时区逐日检查专注分钟是否达到 minMinutes
+// 冻结卡：每连续达标 STREAK_FREEZE_EVERY 天获得一张（最多持有 STREAK_FREEZE_MAX 张），
+// 漏掉的某天自动消耗一张冻结卡，连续不断；没有冻结卡时连续中断
+// 冻结卡完全由历史数据推算，不单独存储，修改/删除历史会话后结果随之变化
+func (f *Focus) computeStreaks(o owner, loc *time.Location, minMinutes int) streakResult {
+	today := dayStart(time.Now(), loc)
+	days := f.dailyTotals(o, loc, time.Date(2000, 1, 1, 0, 0, 0, 0, loc), addDays(today, 1))
+	return streaksFromDays(days, today, minMinutes, f.Cfg.StreakFreezeEvery, f.Cfg.StreakFreezeMax)
+}
+
+// streaksFromDays 在每日汇总上推算连续天数与冻结卡，today 为当地今天的 0 点
+func streaksFromDays(days map[string]dayTotal, today time.Time, minMinutes, every, maxTokens int) streakResult {
+	res := streakResult{MinMinutes: minMinutes, History: []streak{}}
+	loc := today.Location()
+
+	var first time.Time
+	for k, t := range days {
+		d, _ := time.ParseInLocation("2006-01-02", k, loc)
+		if t.Seconds >= int64(minMinutes)*60 && (first.IsZero() || d.Before(first)) {
+			first = d
+		}
+	}
+	if first.IsZero() {
+		return res
+	}
+
+	var cur streak
+	tokens, sinceEarn := 0, 0
+	closeStreak := func() {
+		if cur.Days > 0 {
+			res.History = append(res.History, cur)
+			res.Longest = max(res.Longest, cur.Days)
+		}
+		cur = streak{}
+	}
+	for d := first; !d.After(today); d = addDays(d, 1) {
+		key := d.Format("2006-01-02")
+		switch {
+		case days[key].Seconds >= int64(minMinutes)*60:
+			if cur.Days == 0 {
+				cur.Start = key
+			}
+			cur.Days++
+			cur.End = key
+			sinceEarn++
+			if every > 0 && sinceEarn >= every {
+				tokens, sinceEarn = min(tokens+1, maxTokens), 0
+			}
+			if d.Equal(today) {
+				res.TodayDone = true
+			}
+		case d.Equal(today):
+			// 今天还没结束，不算中断
+		case cur.Days > 0 && tokens > 0:
+			tokens--
+			cur.Frozen++
+		default:
+			closeStreak()
+			sinceEarn = 0
+		}
+	}
+	res.Current = cur.Days
+	res.FreezeTokens = tokens
+	closeStreak()
+
+	// 由近到远
+	for i, j := 0, len(res.History)-1; i < j; i, j = i+1, j-1 {
+		res.History[i], res.History[j] = res.History[j], res.History[i]
+	}
+	if len(res.History) > 50 {
+		res.History = res.History[:50]
+	}
+	return res
+}
+
+// streakMinMinutes 每天达标的最少分钟数：?min_minutes= 覆盖 STREAK_MIN_MINUTES
+func (f *Focus) streakMinMinutes(c *gin.Context) int {
+	if n, err := strconv.Atoi(c.Query("min_minutes")); err == nil && n >= 1 && n <= 1440 {
+		return n
+	}
+	return max(f.Cfg.StreakMinMinutes, 1)
+}
+
+// Streaks GET /api/v1/stats/streaks?min_minutes=
+// 当前连续天数、最长连续天数与历史上每一段连续
+func (f *Focus) Streaks(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	c.JSON(200, f.computeStreaks(o, f.location(c, o), f.streakMinMinutes(c)))
+}
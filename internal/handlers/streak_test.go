@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// activeDays 构造每日汇总：列出的日期各专注 minutes 分钟
+func activeDays(minutes int64, keys ...string) map[string]dayTotal {
+	days := map[string]dayTotal{}
+	for _, k := range keys {
+		days[k] = dayTotal{Seconds: minutes * 60, Sessions: 1}
+	}
+	return days
+}
+
+func mustDay(t *testing.T, key string, loc *time.Location) time.Time {
+	t.Helper()
+	d, err := time.ParseInLocation("2006-01-02", key, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestStreaksFromDays(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name         string
+		days         map[string]dayTotal
+		today        string
+		loc          *time.Location
+		every, max   int
+		wantCurrent  int
+		wantLongest  int
+		wantTokens   int
+		wantToday    bool
+		wantHistory  int
+		wantFrozen   int // 最近一段用掉的冻结卡
+		wantRecentAt string
+	}{
+		{
+			name:         "漏掉的一天用冻结卡补上",
+			days:         activeDays(30, "2025-03-01", "2025-03-02", "2025-03-03", "2025-03-05", "2025-03-06"),
+			today:        "2025-03-06",
+			loc:          time.UTC,
+			every:        3,
+			max:          2,
+			wantCurrent:  5,
+			wantLongest:  5,
+			wantTokens:   0,
+			wantToday:    true,
+			wantHistory:  1,
+			wantFrozen:   1,
+			wantRecentAt: "2025-03-01",
+		},
+		{
+			name:         "漏掉的天数超过冻结卡，连续中断",
+			days:         activeDays(30, "2025-03-01", "2025-03-02", "2025-03-03", "2025-03-06", "2025-03-07"),
+			today:        "2025-03-07",
+			loc:          time.UTC,
+			every:        3,
+			max:          2,
+			wantCurrent:  2,
+			wantLongest:  3,
+			wantTokens:   0,
+			wantToday:    true,
+			wantHistory:  2,
+			wantFrozen:   0,
+			wantRecentAt: "2025-03-06",
+		},
+		{
+			name:         "夏令时结束当天（25 小时）只算一天",
+			days:         activeDays(30, "2025-11-01", "2025-11-02", "2025-11-03"),
+			today:        "2025-11-03",
+			loc:          ny,
+			every:        0,
+			max:          0,
+			wantCurrent:  3,
+			wantLongest:  3,
+			wantToday:    true,
+			wantHistory:  1,
+			wantRecentAt: "2025-11-01",
+		},
+		{
+			name:         "夏令时开始当天（23 小时）不会被跳过",
+			days:         activeDays(30, "2025-03-08", "2025-03-09", "2025-03-10"),
+			today:        "2025-03-10",
+			loc:          ny,
+			every:        0,
+			max:          0,
+			wantCurrent:  3,
+			wantLongest:  3,
+			wantToday:    true,
+			wantHistory:  1,
+			wantRecentAt: "2025-03-08",
+		},
+		{
+			name: "今天还没达标，截止昨天的连续仍算当前",
+			days: func() map[string]dayTotal {
+				d := activeDays(30, "2025-03-01", "2025-03-02", "2025-03-03")
+				d["2025-03-04"] = dayTotal{Seconds: 60, Sessions: 1} // 不足 min_minutes
+				return d
+			}(),
+			today:        "2025-03-04",
+			loc:          time.UTC,
+			every:        7,
+			max:          2,
+			wantCurrent:  3,
+			wantLongest:  3,
+			wantTokens:   0,
+			wantToday:    false,
+			wantHistory:  1,
+			wantRecentAt: "2025-03-01",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := streaksFromDays(tc.days, mustDay(t, tc.today, tc.loc), 5, tc.every, tc.max)
+			if res.Current != tc.wantCurrent || res.Longest != tc.wantLongest {
+				t.Errorf("current/longest = %d/%d, want %d/%d", res.Current, res.Longest, tc.wantCurrent, tc.wantLongest)
+			}
+			if res.FreezeTokens != tc.wantTokens {
+				t.Errorf("freeze_tokens = %d, want %d", res.FreezeTokens, tc.wantTokens)
+			}
+			if res.TodayDone != tc.wantToday {
+				t.Errorf("today_done = %v, want %v", res.TodayDone, tc.wantToday)
+			}
+			if len(res.History) != tc.wantHistory {
+				t.Fatalf("history = %+v, want %d entries", res.History, tc.wantHistory)
+			}
+			if recent := res.History[0]; recent.Start != tc.wantRecentAt || recent.Frozen != tc.wantFrozen {
+				t.Errorf("recent streak = %+v, want start %s frozen %d", recent, tc.wantRecentAt, tc.wantFrozen)
+			}
+		})
+	}
+}
+
+func TestStreaksFromDaysEmpty(t *testing.T) {
+	res := streaksFromDays(map[string]dayTotal{}, mustDay(t, "2025-03-01", time.UTC), 5, 7, 2)
+	if res.Current != 0 || res.Longest != 0 || len(res.History) != 0 || res.History == nil {
+		t.Errorf("empty result = %+v", res)
+	}
+}
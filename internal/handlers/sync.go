@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+var errSyncDeleted = errors.New("该会话已在服务端删除")
+
+// POST /api/v1/sessions/sync
+// 客户端离线时自己记录的生命周期事件，联网后批量上传
+// 事件时间优先用单调时钟换算：服务端收到请求的时刻 - (mono_now - mono)，不受客户端改系统时间影响；
+// 没有单调时钟读数时用客户端墙上时间 at，并按 client_now 与服务端时间的差值校正
+type syncReq struct {
+	MonoNow   *int64      `json:"mono_now"`   // 发送请求时客户端单调时钟读数（毫秒）
+	ClientNow *time.Time  `json:"client_now"` // 发送请求时客户端的墙上时间
+	Events    []syncEvent `json:"events"`
+}
+
+type syncEvent struct {
+	ID      string     `json:"id"`       // 客户端生成的事件 ID，重复上传时据此跳过已应用的事件（老客户端可不传）
+	LocalID string     `json:"local_id"` // 客户端生成的会话 ID，同一会话的事件相同
+	Type    string     `json:"type"`     // start、pause、resume、finish、cancel
+	Mono    *int64     `json:"mono"`     // 事件发生时的单调时钟读数（毫秒）
+	At      *time.Time `json:"at"`       // 事件发生时的墙上时间
+
+	// 以下仅 pause 事件使用，含义同 POST /sessions/pause
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+
+	// 以下仅 start 事件使用，含义同 POST /sessions/start
+	Mode           string   `json:"mode"`
+	PlannedMinutes *int     `json:"planned_minutes"`
+	TaskName       *string  `json:"task_name"`
+	TaskID         *uint    `json:"task_id"`
+	Tags           []string `json:"tags"`
+
+	index int       // 在请求 events 中的下标
+	at    time.Time // 换算后的服务端时间
+}
+
+// syncConflict 没有被应用的事件（或整组会话）及原因
+type syncConflict struct {
+	Index   int    `json:"index"` // 对应请求 events 的下标，整组被拒时为该组第一个事件
+	Type    string `json:"type"`
+	Reason  string `json:"reason"` // invalid_event、not_started、illegal_transition、overlap、active_exists、deleted
+	Message string `json:"message"`
+}
+
+// syncResult 每个 local_id 的对账结果
+// result：applied 全部应用；partial 部分事件冲突；unchanged 事件都已同步过；conflict 整组被拒
+type syncResult struct {
+	LocalID   string          `json:"local_id"`
+	Result    string          `json:"result"`
+	Session   *models.Session `json:"session"`
+	Conflicts []syncConflict  `json:"conflicts,omitempty"`
+}
+
+// SyncSessions 按事件重建会话与片段，和服务端已有的数据对账后返回每个会话的最终状态
+// 每个 local_id 在独立的事务里处理，一组冲突不影响其它组；同一批事件重复上传是幂等的
+func (f *Focus) SyncSessions(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req syncReq
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Events) == 0 {
+		c.JSON(400, gin.H{"message": "需要 events"})
+		return
+	}
+	if len(req.Events) > 500 {
+		c.JSON(400, gin.H{"message": "单次最多同步 500 个事件"})
+		return
+	}
+	now := time.Now()
+	order, groups, invalid := req.group(now)
+
+	results := make([]syncResult, 0, len(order))
+	for _, ref := range order {
+		res, err := f.syncGroup(o, ref, groups[ref], now)
+		if err != nil {
+			c.JSON(500, gin.H{"message": err.Error()})
+			return
+		}
+		results = append(results, res)
+	}
+
+	var current *models.Session
+	if s, ok := f.findMutable(o); ok {
+		current = &s
+	}
+	c.JSON(200, gin.H{
+		"results":     results,
+		"invalid":     invalid,
+		"current":     current,
+		"server_time": now,
+	})
+}
+
+// group 按 local_id 分组，组的顺序按首次出现的位置，组内按换算后的时间排序（时间相同保持上传顺序）
+// 缺少 local_id、时间或 ID 过长的事件放进 invalid
+func (r syncReq) group(now time.Time) ([]string, map[string][]syncEvent, []syncConflict) {
+	var order []string
+	groups := map[string][]syncEvent{}
+	var invalid []syncConflict
+	for i, ev := range r.Events {
+		ev.index = i
+		at, ok := r.resolve(ev, now)
+		if !ok || ev.LocalID == "" || len(ev.LocalID) > 64 || len(ev.ID) > 64 {
+			invalid = append(invalid, syncConflict{i, ev.Type, "invalid_event", "缺少 local_id 或事件时间"})
+			continue
+		}
+		ev.at = at
+		if _, seen := groups[ev.LocalID]; !seen {
+			order = append(order, ev.LocalID)
+		}
+		groups[ev.LocalID] = append(groups[ev.LocalID], ev)
+	}
+	for _, evs := range groups {
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].at.Before(evs[j].at) })
+	}
+	return order, groups, invalid
+}
+
+// pendingEvents 去掉已经同步过的事件：带 ID 的按 seen 去重（同一批里重复的 ID 也只留第一个），
+// 没带 ID 的只保留晚于 synced（服务端会话最后一次状态变化）的；synced 为 nil 表示服务端还没有这个会话
+func pendingEvents(evs []syncEvent, seen map[string]bool, synced *time.Time) []syncEvent {
+	out := make([]syncEvent, 0, len(evs))
+	for _, ev := range evs {
+		if ev.ID != "" {
+			if seen[ev.ID] {
+				continue
+			}
+			seen[ev.ID] = true
+		} else if synced != nil && !ev.at.After(*synced) {
+			continue
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+// resolve 把事件换算成服务端时间，不会晚于 now
+// 截断到微秒，与 PostgreSQL 存下来的精度一致，重复上传时才能和已保存的片段时间比较
+func (r syncReq) resolve(ev syncEvent, now time.Time) (time.Time, bool) {
+	var at time.Time
+	switch {
+	case ev.Mono != nil && r.MonoNow != nil && *ev.Mono <= *r.MonoNow:
+		at = now.Add(-time.Duration(*r.MonoNow-*ev.Mono) * time.Millisecond)
+	case ev.At != nil && r.ClientNow != nil:
+		at = ev.At.Add(now.Sub(*r.ClientNow))
+	case ev.At != nil:
+		at = *ev.At
+	default:
+		return at, false
+	}
+	return minTime(at.UTC(), now).Truncate(time.Microsecond), true
+}
+
+// syncReplay 在内存里按事件推演一个会话的状态与片段
+// pauses 记录新应用的 pause 事件收口的片段下标，保存片段后据此写中断记录
+type syncReplay struct {
+	status string
+	segs   []models.Segment
+	pauses []syncPause
+}
+
+type syncPause struct {
+	seg  int
+	intr models.Interruption
+}
+
+func (r *syncReplay) apply(typ string, at time.Time) (string, string) {
+	to := map[string]string{
+		"pause":  models.SessionPaused,
+		"resume": models.SessionStarted,
+		"finish": models.SessionFinished,
+		"cancel": models.SessionCanceled,
+	}[typ]
+	switch {
+	case r.status == "":
+		return "not_started", "该会话还没有 start 事件"
+	case to == "" || !models.CanTransition(r.status, to):
+		return "illegal_transition", errIllegalTransition.Error()
+	}
+	if to == models.SessionStarted {
+		r.segs = append(r.segs, models.Segment{StartAt: at})
+	} else if last := &r.segs[len(r.segs)-1]; last.EndAt == nil {
+		end := at
+		last.EndAt = &end
+	}
+	r.status = to
+	return "", ""
+}
+
+// start 从 start 事件推演出第一个片段
+func (r *syncReplay) start(at time.Time) {
+	r.status = models.SessionStarted
+	r.segs = []models.Segment{{StartAt: at}}
+}
+
+// lastChange 最后一次状态变化的时刻
+func (r *syncReplay) lastChange() time.Time {
+	last := r.segs[len(r.segs)-1]
+	if last.EndAt != nil {
+		return *last.EndAt
+	}
+	return last.StartAt
+}
+
+// seconds 已结束片段的累计秒数，以及算到 now 的总秒数
+func (r *syncReplay) seconds(now time.Time) (closed, total int64) {
+	for _, sg := range r.segs {
+		if sg.EndAt == nil {
+			total += int64(now.Sub(sg.StartAt).Seconds())
+			continue
+		}
+		d := int64(sg.EndAt.Sub(sg.StartAt).Seconds())
+		closed += d
+		total += d
+	}
+	return closed, total
+}
+
+// syncGroup 对账一个 local_id：服务端已有（client_ref 相同）的会话跳过已应用过的事件 ID，
+// 没带 ID 的事件只应用晚于其最后一次状态变化的，
+// 没有则从 start 事件新建；推演出的会话与其它会话重叠、或仍在进行中而服务端已有另一条进行中的会话时整组拒绝
+func (f *Focus) syncGroup(o owner, ref string, evs []syncEvent, now time.Time) (syncResult, error) {
+	res := syncResult{LocalID: ref}
+	var sess models.Session
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(o.scope).
+			Where("client_ref=?", ref).Take(&sess).Error
+		exists := err == nil
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if exists && sess.DeletedAt.Valid {
+			return errSyncDeleted
+		}
+
+		var r syncReplay
+		var synced *time.Time
+		seen := map[string]bool{}
+		if exists {
+			var ids []string
+			if err := tx.Model(&models.SyncedEvent{}).Where("session_id=?", sess.ID).
+				Pluck("event_id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				seen[id] = true
+			}
+			r.status = sess.Status
+			if err := tx.Where("session_id=?", sess.ID).Order("start_at ASC").Find(&r.segs).Error; err != nil {
+				return err
+			}
+			if len(r.segs) == 0 {
+				return errIllegalTransition
+			}
+			last := r.lastChange()
+			synced = &last
+		}
+		wasStatus := r.status
+
+		var appliedIDs []string
+		for _, ev := range pendingEvents(evs, seen, synced) {
+			var reason, msg string
+			if ev.Type == "start" {
+				reason, msg = f.syncStart(tx, o, &r, &sess, ev)
+			} else {
+				reason, msg = r.apply(ev.Type, ev.at)
+			}
+			if reason == "" && ev.Type == "pause" {
+				rs := ev.Reason
+				if !models.ValidInterruptionReason(rs) {
+					rs = models.InterruptionUnspecified
+				}
+				r.pauses = append(r.pauses, syncPause{len(r.segs) - 1,
+					models.Interruption{Reason: rs, Note: ev.Note, At: ev.at}})
+			}
+			if reason != "" {
+				res.Conflicts = append(res.Conflicts, syncConflict{ev.index, ev.Type, reason, msg})
+				continue
+			}
+			appliedIDs = append(appliedIDs, ev.ID)
+		}
+		if len(appliedIDs) == 0 {
+			return nil
+		}
+
+		start := r.segs[0].StartAt
+		end := now
+		if r.status == models.SessionFinished || r.status == models.SessionCanceled {
+			end = r.lastChange()
+		}
+		closed, total := r.seconds(now)
+		// 与 closeSession 一致：不足 1 分钟的结束按取消处理
+		if r.status == models.SessionFinished && total < 60 {
+			r.status = models.SessionCanceled
+		}
+		// 取消的会话不占时间段（与 overlaps 的口径一致）
+		if r.status != models.SessionCanceled {
+			if hit, err := overlaps(tx, o, sess.ID, start, end); err != nil {
+				return err
+			} else if hit {
+				return errOverlap
+			}
+		}
+		mutable := r.status == models.SessionStarted || r.status == models.SessionPaused
+		if mutable {
+			if cur, err := lockMutable(tx, o); err == nil && cur.ID != sess.ID {
+				return errActiveExists
+			}
+		}
+
+		sess.Status, sess.StartAt, sess.DurationSec, sess.EndAt = r.status, start, closed, nil
+		if !mutable {
+			sess.EndAt = &end
+		}
+		if exists {
+			err = tx.Model(&sess).Updates(map[string]any{
+				"status": sess.Status, "start_at": start, "end_at": sess.EndAt, "duration_sec": closed,
+			}).Error
+		} else {
+			sess.VisitorID, sess.UserID, sess.ClientRef = o.VisitorID, o.UserID, &ref
+			err = tx.Create(&sess).Error
+		}
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errActiveExists
+		}
+		if err != nil {
+			return err
+		}
+		for i := range r.segs {
+			r.segs[i].SessionID = sess.ID
+			if err := tx.Save(&r.segs[i]).Error; err != nil {
+				return err
+			}
+		}
+		for _, id := range appliedIDs {
+			if id == "" {
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.SyncedEvent{SessionID: sess.ID, EventID: id}).Error; err != nil {
+				return err
+			}
+		}
+		for _, p := range r.pauses {
+			p.intr.SessionID, p.intr.SegmentID = sess.ID, r.segs[p.seg].ID
+			if err := tx.Create(&p.intr).Error; err != nil {
+				return err
+			}
+		}
+		switch {
+		case r.status == models.SessionFinished && wasStatus != models.SessionFinished:
+			if _, err := creditFinished(tx, sess, closed, end); err != nil {
+				return err
+			}
+		case r.status == models.SessionCanceled && wasStatus != models.SessionCanceled:
+			if err := refreshRollup(tx, o, end); err != nil {
+				return err
+			}
+			if err := onSessionClosed(tx, sess, 0, false, end); err != nil {
+				return err
+			}
+		}
+		res.Result = "applied"
+		if len(res.Conflicts) > 0 {
+			res.Result = "partial"
+		}
+		return nil
+	})
+
+	var reason string
+	switch {
+	case errors.Is(err, errOverlap):
+		reason = "overlap"
+	case errors.Is(err, errActiveExists):
+		reason = "active_exists"
+	case errors.Is(err, errSyncDeleted):
+		reason = "deleted"
+	case errors.Is(err, errIllegalTransition):
+		reason = "illegal_transition"
+	case err != nil:
+		return res, err
+	}
+	if reason != "" {
+		res.Result = "conflict"
+		res.Conflicts = []syncConflict{{evs[0].index, evs[0].Type, reason, err.Error()}}
+	} else if res.Result == "" {
+		res.Result = "unchanged"
+		if len(res.Conflicts) > 0 {
+			res.Result = "conflict"
+		}
+	}
+
+	// 返回服务端的最终状态（整组被拒时是服务端原有的那条，可能不存在）
+	var saved models.Session
+	if f.DB.Scopes(o.scope).
+		Preload("Segments", func(db *gorm.DB) *gorm.DB { return db.Order("start_at ASC") }).
+		Preload("Tags").Where("client_ref=?", ref).Take(&saved).Error == nil {
+		res.Session = &saved
+	}
+	return res, nil
+}
+
+// syncStart 处理 start 事件：校验参数并填好待新建会话的字段，推演出第一个片段
+func (f *Focus) syncStart(tx *gorm.DB, o owner, r *syncReplay, sess *models.Session, ev syncEvent) (string, string) {
+	if r.status != "" {
+		return "illegal_transition", "该会话已经开始"
+	}
+	mode := ev.Mode
+	if mode == "" {
+		mode = "stopwatch"
+	}
+	switch mode {
+	case "stopwatch":
+	case "countdown":
+		if ev.PlannedMinutes == nil || *ev.PlannedMinutes <= 0 || *ev.PlannedMinutes > 1440 {
+			return "invalid_event", "倒计时需要 planned_minutes（1-1440）"
+		}
+	default:
+		return "invalid_event", "离线同步只支持 stopwatch 与 countdown"
+	}
+	taskName, err := f.resolveTask(tx, o, ev.TaskID, ev.TaskName)
+	if err != nil {
+		return "invalid_event", err.Error()
+	}
+	tags, err := resolveTags(tx, o, ev.Tags)
+	if err != nil {
+		return "invalid_event", err.Error()
+	}
+	sess.Mode, sess.PlannedMinutes, sess.TaskID, sess.TaskName, sess.Tags = mode, ev.PlannedMinutes, ev.TaskID, taskName, tags
+	r.start(ev.at)
+	return "", ""
+}
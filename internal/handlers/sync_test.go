@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+var syncT0 = time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// ev 构造一个同一 local_id 下的事件，min 为相对 syncT0 的分钟数
+func ev(id, typ string, min int) syncEvent {
+	at := syncT0.Add(time.Duration(min) * time.Minute)
+	return syncEvent{ID: id, LocalID: "L1", Type: typ, At: &at}
+}
+
+// replay 按 syncGroup 的方式推演一组事件（start 不经过数据库），返回推演结果与冲突原因
+func replay(r syncReplay, evs []syncEvent) (syncReplay, []string) {
+	var reasons []string
+	for _, e := range evs {
+		if e.Type == "start" {
+			if r.status != "" {
+				reasons = append(reasons, "illegal_transition")
+				continue
+			}
+			r.start(e.at)
+			continue
+		}
+		if reason, _ := r.apply(e.Type, e.at); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return r, reasons
+}
+
+func TestSyncReplay(t *testing.T) {
+	now := syncT0.Add(2 * time.Hour)
+	cases := []struct {
+		name       string
+		events     []syncEvent
+		seen       []string // 服务端已记录的事件 ID
+		wantStatus string
+		wantSegs   int
+		wantClosed int64
+		wantLast   time.Time
+		wantReason []string
+	}{
+		{
+			name: "乱序上传按时间重排",
+			events: []syncEvent{
+				ev("d", "finish", 30), ev("a", "start", 0), ev("c", "resume", 20), ev("b", "pause", 10),
+			},
+			wantStatus: models.SessionFinished,
+			wantSegs:   2,
+			wantClosed: 20 * 60,
+			wantLast:   syncT0.Add(30 * time.Minute),
+		},
+		{
+			name: "同一批里重复的事件 ID 只应用一次",
+			events: []syncEvent{
+				ev("a", "start", 0), ev("b", "pause", 10), ev("b", "pause", 10),
+				ev("c", "resume", 15), ev("c", "resume", 15), ev("d", "finish", 25),
+			},
+			wantStatus: models.SessionFinished,
+			wantSegs:   2,
+			wantClosed: 20 * 60,
+			wantLast:   syncT0.Add(25 * time.Minute),
+		},
+		{
+			name:       "已同步过的事件 ID 被跳过",
+			events:     []syncEvent{ev("a", "start", 0), ev("b", "pause", 10), ev("c", "resume", 12)},
+			seen:       []string{"b"},
+			wantStatus: models.SessionStarted,
+			wantSegs:   1,
+			wantClosed: 0,
+			wantLast:   syncT0,
+			wantReason: []string{"illegal_transition"},
+		},
+		{
+			name:       "暂停后没有继续直接结束，只计到暂停",
+			events:     []syncEvent{ev("a", "start", 0), ev("b", "pause", 10), ev("c", "finish", 40)},
+			wantStatus: models.SessionFinished,
+			wantSegs:   1,
+			wantClosed: 10 * 60,
+			wantLast:   syncT0.Add(10 * time.Minute),
+		},
+		{
+			name:       "暂停后没有继续，停在 paused",
+			events:     []syncEvent{ev("a", "start", 0), ev("b", "pause", 10), ev("c", "pause", 20)},
+			wantStatus: models.SessionPaused,
+			wantSegs:   1,
+			wantClosed: 10 * 60,
+			wantLast:   syncT0.Add(10 * time.Minute),
+			wantReason: []string{"illegal_transition"},
+		},
+		{
+			name:       "没有 start 的 finish",
+			events:     []syncEvent{ev("a", "finish", 5)},
+			wantStatus: "",
+			wantReason: []string{"not_started"},
+		},
+		{
+			name:       "结束后再次 finish",
+			events:     []syncEvent{ev("a", "start", 0), ev("b", "finish", 5), ev("c", "finish", 6)},
+			wantStatus: models.SessionFinished,
+			wantSegs:   1,
+			wantClosed: 5 * 60,
+			wantLast:   syncT0.Add(5 * time.Minute),
+			wantReason: []string{"illegal_transition"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, groups, invalid := syncReq{Events: tc.events}.group(now)
+			if len(invalid) != 0 {
+				t.Fatalf("invalid = %v", invalid)
+			}
+			seen := map[string]bool{}
+			for _, id := range tc.seen {
+				seen[id] = true
+			}
+			r, reasons := replay(syncReplay{}, pendingEvents(groups["L1"], seen, nil))
+			if r.status != tc.wantStatus {
+				t.Errorf("status = %q, want %q", r.status, tc.wantStatus)
+			}
+			if !reflect.DeepEqual(reasons, tc.wantReason) {
+				t.Errorf("conflicts = %v, want %v", reasons, tc.wantReason)
+			}
+			if len(r.segs) != tc.wantSegs {
+				t.Fatalf("segments = %d, want %d", len(r.segs), tc.wantSegs)
+			}
+			if tc.wantSegs == 0 {
+				return
+			}
+			if closed, _ := r.seconds(now); closed != tc.wantClosed {
+				t.Errorf("closed = %d, want %d", closed, tc.wantClosed)
+			}
+			if last := r.lastChange(); !last.Equal(tc.wantLast) {
+				t.Errorf("lastChange = %v, want %v", last, tc.wantLast)
+			}
+		})
+	}
+}
+
+func TestPendingEvents(t *testing.T) {
+	synced := syncT0.Add(10 * time.Minute)
+	withAt := func(e syncEvent) syncEvent { e.at = *e.At; return e }
+	evs := []syncEvent{
+		withAt(ev("", "pause", 10)),  // 没有 ID，不晚于服务端最后一次变化：已同步过
+		withAt(ev("a", "resume", 5)), // 有 ID 且没见过：即使时间较早也要应用
+		withAt(ev("b", "pause", 12)), // 服务端已记录
+		withAt(ev("", "resume", 15)), // 没有 ID，晚于服务端：应用
+	}
+	got := pendingEvents(evs, map[string]bool{"b": true}, &synced)
+	var types []string
+	for _, e := range got {
+		types = append(types, e.ID+":"+e.Type)
+	}
+	want := []string{"a:resume", ":resume"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("pending = %v, want %v", types, want)
+	}
+}
+
+func TestSyncGroupInvalid(t *testing.T) {
+	at := syncT0
+	req := syncReq{Events: []syncEvent{
+		{LocalID: "L1", Type: "start"},          // 没有时间
+		{Type: "start", At: &at},                // 没有 local_id
+		{LocalID: "L2", Type: "start", At: &at}, // 正常
+	}}
+	order, groups, invalid := req.group(syncT0.Add(time.Hour))
+	if !reflect.DeepEqual(order, []string{"L2"}) || len(groups["L2"]) != 1 {
+		t.Errorf("order = %v, groups = %v", order, groups)
+	}
+	if len(invalid) != 2 || invalid[0].Index != 0 || invalid[1].Index != 1 {
+		t.Errorf("invalid = %v", invalid)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// ListTags GET /api/v1/tags
+func (f *Focus) ListTags(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var tags []models.Tag
+	f.DB.Scopes(o.scope).Order("category ASC, name ASC").Find(&tags)
+	c.JSON(200, tags)
+}
+
+// POST /api/v1/tags、PATCH /api/v1/tags/:id
+type tagReq struct {
+	Name     *string `json:"name"`
+	Category *string `json:"category"`
+	Color    *string `json:"color"`
+}
+
+// CreateTag 新建标签；同名标签已存在时直接返回已有的
+func (f *Focus) CreateTag(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req tagReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == nil || !validTagName(*req.Name) {
+		c.JSON(400, gin.H{"message": "标签名不合法"})
+		return
+	}
+	tags, err := resolveTags(f.DB, o, []string{*req.Name})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	t := tags[0]
+	updates := map[string]any{}
+	if req.Category != nil {
+		updates["category"] = strings.TrimSpace(*req.Category)
+	}
+	if req.Color != nil {
+		updates["color"] = *req.Color
+	}
+	if len(updates) > 0 {
+		if err := f.DB.Model(&t).Updates(updates).Error; err != nil {
+			c.JSON(500, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	c.JSON(200, t)
+}
+
+// UpdateTag PATCH /api/v1/tags/:id  改名、改分类或颜色；改成已有的名称（不区分大小写）返回 409
+func (f *Focus) UpdateTag(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	t, ok := f.findTag(o, c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"message": "标签不存在"})
+		return
+	}
+	var req tagReq
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Name != nil && !validTagName(*req.Name)) {
+		c.JSON(400, gin.H{"message": "标签名不合法"})
+		return
+	}
+	updates := map[string]any{}
+	if req.Name != nil {
+		updates["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.Category != nil {
+		updates["category"] = strings.TrimSpace(*req.Category)
+	}
+	if req.Color != nil {
+		updates["color"] = *req.Color
+	}
+	if len(updates) > 0 {
+		err := f.DB.Model(&t).Updates(updates).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(409, gin.H{"message": "同名标签已存在"})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	c.JSON(200, t)
+}
+
+// DeleteTag DELETE /api/v1/tags/:id  删除标签并解除与会话的关联（会话本身保留）
+func (f *Focus) DeleteTag(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	t, ok := f.findTag(o, c.Param("id"))
+	if !ok {
+		c.JSON(404, gin.H{"message": "标签不存在"})
+		return
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM session_tags WHERE tag_id=?", t.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&t).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// findTag 按路径参数查找该归属者的标签
+func (f *Focus) findTag(o owner, idStr string) (models.Tag, bool) {
+	var t models.Tag
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return t, false
+	}
+	return t, f.DB.Scopes(o.scope).Where("id=?", id).Take(&t).Error == nil
+}
+
+// findTagByName 按名称查找该归属者的标签，不区分大小写
+func findTagByName(db *gorm.DB, o owner, name string) (models.Tag, error) {
+	var t models.Tag
+	err := db.Scopes(o.scope).Where("lower(name)=lower(?)", name).Take(&t).Error
+	return t, err
+}
+
+func validTagName(name string) bool {
+	name = strings.TrimSpace(name)
+	return name != "" && len([]rune(name)) <= 20
+}
+
+// resolveTags 按名称（不区分大小写）取该归属者的标签，不存在的自动创建（开始/结束专注时直接传标签名）
+// 并发请求同时创建同名标签时由唯一索引兜底：插入冲突的一方改为读取已有的那个
+func resolveTags(db *gorm.DB, o owner, names []string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if !validTagName(name) || seen[key] {
+			continue
+		}
+		seen[key] = true
+		t, err := findTagByName(db, o, name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			t = models.Tag{VisitorID: o.VisitorID, UserID: o.UserID, Name: name}
+			err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&t).Error
+			if err == nil && t.ID == 0 {
+				t, err = findTagByName(db, o, name)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+var errTaskNotFound = errors.New("任务不存在")
+
+// taskStat 任务的专注统计（由会话片段汇总）
+type taskStat struct {
+	TaskID     uint  `json:"-"`
+	FocusedSec int64 `json:"focused_sec"` // 已完成会话的片段累计秒数
+	Pomodoros  int64 `json:"pomodoros"`   // 完整跑完计划时长的番茄钟/倒计时次数
+}
+
+// taskResp 任务 + 统计
+type taskResp struct {
+	models.Task
+	taskStat
+}
+
+// GET /api/v1/tasks?status=todo
+// 按 sort_order 升序返回任务及其专注统计
+func (f *Focus) ListTasks(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	q := f.DB.Scopes(o.scope)
+	if st := c.Query("status"); st != "" {
+		q = q.Where("status=?", st)
+	}
+	var tasks []models.Task
+	q.Order("sort_order ASC, id ASC").Find(&tasks)
+	c.JSON(200, f.withTaskStats(tasks))
+}
+
+// POST /api/v1/tasks、PATCH /api/v1/tasks/:id
+// PATCH 时只更新传了的字段
+type taskReq struct {
+	Title              *string `json:"title"`
+	Notes              *string `json:"notes"`
+	EstimatedPomodoros *int    `json:"estimated_pomodoros"`
+	Status             *string `json:"status"`
+}
+
+func (r taskReq) validate() bool {
+	if r.Title != nil && (strings.TrimSpace(*r.Title) == "" || len(*r.Title) > 200) {
+		return false
+	}
+	if r.EstimatedPomodoros != nil && (*r.EstimatedPomodoros < 0 || *r.EstimatedPomodoros > 100) {
+		return false
+	}
+	if r.Status != nil && *r.Status != "todo" && *r.Status != "doing" && *r.Status != "done" {
+		return false
+	}
+	return true
+}
+
+// CreateTask 新建任务，排在列表最后
+func (f *Focus) CreateTask(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req taskReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == nil || !req.validate() {
+		c.JSON(400, gin.H{"message": "任务参数不合法"})
+		return
+	}
+	var last int
+	f.DB.Model(&models.Task{}).Scopes(o.scope).Select("COALESCE(MAX(sort_order), 0)").Scan(&last)
+	t := models.Task{
+		VisitorID: o.VisitorID,
+		UserID:    o.UserID,
+		Title:     strings.TrimSpace(*req.Title),
+		Status:    "todo",
+		SortOrder: last + 1,
+	}
+	if req.Notes != nil {
+		t.Notes = *req.Notes
+	}
+	if req.EstimatedPomodoros != nil {
+		t.EstimatedPomodoros = *req.EstimatedPomodoros
+	}
+	if req.Status != nil {
+		t.Status = *req.Status
+	}
+	if t.Status == "done" {
+		now := time.Now()
+		t.CompletedAt = &now
+	}
+	if err := f.DB.Create(&t).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, taskResp{Task: t})
+}
+
+// GetTask GET /api/v1/tasks/:id
+func (f *Focus) GetTask(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	t, err := f.findTask(o, c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, f.withTaskStats([]models.Task{t})[0])
+}
+
+// UpdateTask PATCH /api/v1/tasks/:id
+// 改名、改备注、改预估番茄数或改状态；标记为 done 时记录完成时间
+func (f *Focus) UpdateTask(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	t, err := f.findTask(o, c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"message": err.Error()})
+		return
+	}
+	var req taskReq
+	if err := c.ShouldBindJSON(&req); err != nil || !req.validate() {
+		c.JSON(400, gin.H{"message": "任务参数不合法"})
+		return
+	}
+	updates := map[string]any{}
+	if req.Title != nil {
+		updates["title"] = strings.TrimSpace(*req.Title)
+	}
+	if req.Notes != nil {
+		updates["notes"] = *req.Notes
+	}
+	if req.EstimatedPomodoros != nil {
+		updates["estimated_pomodoros"] = *req.EstimatedPomodoros
+	}
+	if req.Status != nil && *req.Status != t.Status {
+		updates["status"] = *req.Status
+		if *req.Status == "done" {
+			updates["completed_at"] = time.Now()
+		} else {
+			updates["completed_at"] = nil
+		}
+	}
+	if len(updates) > 0 {
+		err := f.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&t).Updates(updates).Error; err != nil {
+				return err
+			}
+			// 任务完成数是成就规则之一
+			if _, ok := updates["status"]; ok {
+				return onAchievementEvent(tx, o, 0, time.Now(), models.RuleTaskCompletion)
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	f.DB.First(&t, t.ID)
+	c.JSON(200, f.withTaskStats([]models.Task{t})[0])
+}
+
+// DeleteTask DELETE /api/v1/tasks/:id
+// 软删除；关联的会话保留 task_id 与 task_name，历史统计不受影响
+func (f *Focus) DeleteTask(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	t, err := f.findTask(o, c.Param("id"))
+	if err != nil {
+		c.JSON(404, gin.H{"message": err.Error()})
+		return
+	}
+	if err := f.DB.Delete(&t).Error; err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// POST /api/v1/tasks/reorder  body: {"ids":[3,1,2]}
+// 按给出的顺序重写 sort_order，不在列表中的任务顺序不变
+type reorderReq struct {
+	IDs []uint `json:"ids"`
+}
+
+func (f *Focus) ReorderTasks(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req reorderReq
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 {
+		c.JSON(400, gin.H{"message": "无效的ids"})
+		return
+	}
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range req.IDs {
+			if err := tx.Model(&models.Task{}).Scopes(o.scope).
+				Where("id=?", id).Update("sort_order", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// findTask 按路径参数查找该归属者的任务
+func (f *Focus) findTask(o owner, idStr string) (models.Task, error) {
+	var t models.Task
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return t, errTaskNotFound
+	}
+	if err := f.DB.Scopes(o.scope).Where("id=?", id).Take(&t).Error; err != nil {
+		return t, errTaskNotFound
+	}
+	return t, nil
+}
+
+// resolveTask 开始专注时校验 task_id 属于当前归属者
+// 没有单独给 task_name 时沿用任务标题；待办状态的任务顺便标记为进行中
+func (f *Focus) resolveTask(db *gorm.DB, o owner, taskID *uint, taskName *string) (*string, error) {
+	t, taskName, err := lookupTask(db, o, taskID, taskName)
+	if err == nil && t.Status == "todo" {
+		db.Model(&t).Update("status", "doing")
+	}
+	return taskName, err
+}
+
+// lookupTask 校验 task_id 属于当前归属者并补上 task_name，不改任务状态（修改已完成的会话时用）
+func lookupTask(db *gorm.DB, o owner, taskID *uint, taskName *string) (models.Task, *string, error) {
+	var t models.Task
+	if taskID == nil {
+		return t, taskName, nil
+	}
+	if err := db.Scopes(o.scope).Where("id=?", *taskID).Take(&t).Error; err != nil {
+		return t, nil, errTaskNotFound
+	}
+	if taskName == nil {
+		taskName = &t.Title
+	}
+	return t, taskName, nil
+}
+
+// withTaskStats 一次查询汇总多个任务的专注秒数与完成的番茄数
+// 专注秒数取已完成会话所有片段的 end_at - start_at 之和；
+// 番茄数取完整跑满 PlannedMinutes 的 pomodoro/countdown 会话个数
+func (f *Focus) withTaskStats(tasks []models.Task) []taskResp {
+	ids := make([]uint, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
+	}
+	stats := map[uint]taskStat{}
+	if len(ids) > 0 {
+		var focused []taskStat
+		f.DB.Table("segments g").
+			Select("s.task_id, COALESCE(SUM(EXTRACT(EPOCH FROM (g.end_at - g.start_at))), 0)::bigint AS focused_sec").
+			Joins("JOIN sessions s ON s.id = g.session_id").
+			Where("s.task_id IN ? AND s.status='finished' AND s.deleted_at IS NULL AND g.end_at IS NOT NULL", ids).
+			Group("s.task_id").Scan(&focused)
+		for _, st := range focused {
+			stats[st.TaskID] = st
+		}
+		var done []taskStat
+		f.DB.Model(&models.Session{}).
+			Select("task_id, COUNT(*) AS pomodoros").
+			Where("task_id IN ? AND status='finished' AND mode IN ('pomodoro','countdown') AND duration_sec >= planned_minutes * 60", ids).
+			Group("task_id").Scan(&done)
+		for _, st := range done {
+			s := stats[st.TaskID]
+			s.Pomodoros = st.Pomodoros
+			stats[st.TaskID] = s
+		}
+	}
+	resp := make([]taskResp, 0, len(tasks))
+	for _, t := range tasks {
+		st := stats[t.ID]
+		st.TaskID = t.ID
+		resp = append(resp, taskResp{Task: t, taskStat: st})
+	}
+	return resp
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
+)
+
+// location 本次请求做日期切分用的时区，优先级：
+// ?tz= 参数 > X-Timezone 请求头 > 归属者保存的设置 > DEFAULT_TIMEZONE
+// 无法识别的时区名忽略，继续往下找
+func (f *Focus) location(c *gin.Context, o owner) *time.Location {
+	for _, name := range []string{c.Query("tz"), c.GetHeader("X-Timezone")} {
+		if loc, ok := loadTimezone(name); ok {
+			return loc
+		}
+	}
+	if loc, err := time.LoadLocation(ownerTimezone(f.DB, o)); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// loadTimezone 解析用户给出的 IANA 时区名
+// time.LoadLocation 会把 "" 当作 UTC、"Local" 当作服务器时区，这两个都不接受
+func loadTimezone(name string) (*time.Location, bool) {
+	if name == "" || name == "Local" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	return loc, err == nil
+}
+
+// 日期切分都用 time.Date 在目标时区里重新构造，而不是加减 24 小时，
+// 这样遇到夏令时切换（当天 23 或 25 小时）边界依然落在当地的 0 点
+
+// dayStart t 所在当地日期的 0 点
+func dayStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// weekStart t 所在周的周一 0 点
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	d := dayStart(t, loc)
+	offset := (int(d.Weekday()) + 6) % 7 // 周一为 0
+	return time.Date(d.Year(), d.Month(), d.Day()-offset, 0, 0, 0, 0, loc)
+}
+
+// monthStart t 所在月的 1 号 0 点
+func monthStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// addDays 当地日期加 n 天后的 0 点
+func addDays(d time.Time, n int) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day()+n, 0, 0, 0, 0, d.Location())
+}
+
+// GetSettings GET /api/v1/settings
+func (f *Focus) GetSettings(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var p models.Preference
+	if f.DB.Scopes(o.scope).Take(&p).Error != nil {
+		p.Timezone = config.DefaultTimezone()
+	}
+	c.JSON(200, p)
+}
+
+// PUT /api/v1/settings
+type settingsReq struct {
+	Timezone *string `json:"timezone"` // IANA 时区名，如 Asia/Shanghai、America/New_York
+}
+
+// UpdateSettings PUT /api/v1/settings  保存个人设置（目前只有时区）
+func (f *Focus) UpdateSettings(c *gin.Context) {
+	o, ok := f.owner(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var req settingsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"message": "参数错误"})
+		return
+	}
+	var p models.Preference
+	if f.DB.Scopes(o.scope).Take(&p).Error != nil {
+		p = models.Preference{VisitorID: o.VisitorID, UserID: o.UserID, Timezone: config.DefaultTimezone()}
+	}
+	oldTZ := p.Timezone
+	if req.Timezone != nil {
+		if _, ok := loadTimezone(*req.Timezone); !ok {
+			c.JSON(400, gin.H{"message": "无法识别的时区"})
+			return
+		}
+		p.Timezone = *req.Timezone
+	}
+	// 时区变了，日汇总的日期切分随之改变，整体重建
+	err := f.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&p).Error; err != nil {
+			return err
+		}
+		if p.Timezone == oldTZ {
+			return nil
+		}
+		return refreshRollup(tx, o)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	c.JSON(200, p)
+}
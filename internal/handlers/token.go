@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// hashToken refresh token 只以 sha256 哈希形式落库
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens 在 familyID 家族下签发一对 access/refresh token；familyID 为空时新建家族
+func (a *Account) issueTokens(db *gorm.DB, c *gin.Context, vid string, userID uint, familyID string) (gin.H, error) {
+	if familyID == "" {
+		familyID = uuid.NewString()
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	rt := models.RefreshToken{
+		TokenHash: hashToken(raw),
+		FamilyID:  familyID,
+		VisitorID: vid,
+		UserAgent: c.GetHeader("User-Agent"),
+		ExpiresAt: time.Now().Add(a.Cfg.RefreshTTL),
+	}
+	if userID != 0 {
+		rt.UserID = &userID
+	}
+	if err := db.Create(&rt).Error; err != nil {
+		return nil, err
+	}
+	access, err := signToken(a.Cfg.JWTSecret, vid, userID, familyID, a.Cfg.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         access,
+		"refresh_token": raw,
+		"expires_in":    int64(a.Cfg.AccessTTL.Seconds()),
+	}, nil
+}
+
+// respondTokens 新建一个 token 家族并返回，extra 中的字段一并写入响应
+func (a *Account) respondTokens(c *gin.Context, vid string, userID uint, extra gin.H) {
+	resp, err := a.issueTokens(a.DB, c, vid, userID, "")
+	if err != nil {
+		c.JSON(500, gin.H{"code": 500, "message": "token错误"})
+		return
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	c.JSON(200, resp)
+}
+
+// revokeFamily 吊销整个 token 家族（该家族签发的 access token 随之失效）
+func revokeFamily(db *gorm.DB, familyID string) error {
+	now := time.Now()
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id=? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", &now).Error
+}
+
+// FamilyActive 判断 token 家族是否仍然有效（供鉴权中间件校验 access token 是否已被吊销）
+func FamilyActive(db *gorm.DB, familyID string) bool {
+	var n int64
+	db.Model(&models.RefreshToken{}).
+		Where("family_id=? AND revoked_at IS NULL", familyID).Count(&n)
+	return n > 0
+}
+
+// POST /api/v1/auth/refresh
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var errTokenReused = errors.New("refresh token 已被使用，该登录已被注销")
+
+// Refresh 用 refresh token 换一对新 token（轮换）
+// 已轮换过的 refresh token 再次出现说明可能被盗用，吊销整个家族
+func (a *Account) Refresh(c *gin.Context) {
+	var req refreshReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(400, gin.H{"message": "缺少 refresh_token"})
+		return
+	}
+	var resp gin.H
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash=?", hashToken(req.RefreshToken)).Take(&rt).Error; err != nil {
+			return err
+		}
+		if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+			return gorm.ErrRecordNotFound
+		}
+		if rt.UsedAt != nil {
+			return errTokenReused
+		}
+		now := time.Now()
+		if err := tx.Model(&rt).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		var uid uint
+		if rt.UserID != nil {
+			uid = *rt.UserID
+		}
+		var err error
+		resp, err = a.issueTokens(tx, c, rt.VisitorID, uid, rt.FamilyID)
+		return err
+	})
+	switch {
+	case errors.Is(err, errTokenReused):
+		// 重放检测：吊销要在事务外提交，不能随事务回滚
+		var rt models.RefreshToken
+		a.DB.Where("token_hash=?", hashToken(req.RefreshToken)).Take(&rt)
+		_ = revokeFamily(a.DB, rt.FamilyID)
+		c.JSON(401, gin.H{"code": 401, "message": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(401, gin.H{"code": 401, "message": "refresh token 无效或已过期"})
+	case err != nil:
+		c.JSON(500, gin.H{"message": err.Error()})
+	default:
+		c.JSON(200, resp)
+	}
+}
+
+// Tokens GET /api/v1/auth/tokens
+// 列出当前游客/用户所有仍然有效的登录（每个家族只有一个未轮换的 refresh token）
+func (a *Account) Tokens(c *gin.Context) {
+	o, ok := ownerFrom(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	var list []models.RefreshToken
+	a.DB.Scopes(o.scope).
+		Where("revoked_at IS NULL AND used_at IS NULL AND expires_at > ?", time.Now()).
+		Order("created_at DESC").Find(&list)
+	fid := c.GetString(CtxFamilyID)
+	resp := make([]gin.H, 0, len(list))
+	for _, t := range list {
+		resp = append(resp, gin.H{
+			"family_id":  t.FamilyID,
+			"user_agent": t.UserAgent,
+			"created_at": t.CreatedAt,
+			"expires_at": t.ExpiresAt,
+			"current":    t.FamilyID == fid,
+		})
+	}
+	c.JSON(200, resp)
+}
+
+// RevokeToken DELETE /api/v1/auth/tokens/:family_id  注销某一个设备上的登录
+func (a *Account) RevokeToken(c *gin.Context) {
+	o, ok := ownerFrom(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	// family_id 列是 uuid 类型，不合法的值直接按不存在处理，避免数据库类型转换报错
+	fid, err := uuid.Parse(c.Param("family_id"))
+	if err != nil {
+		c.JSON(404, gin.H{"message": "登录不存在或已注销"})
+		return
+	}
+	now := time.Now()
+	r := a.DB.Model(&models.RefreshToken{}).Scopes(o.scope).
+		Where("family_id=? AND revoked_at IS NULL", fid.String()).
+		Update("revoked_at", &now)
+	if r.Error != nil {
+		c.JSON(500, gin.H{"message": r.Error.Error()})
+		return
+	}
+	if r.RowsAffected == 0 {
+		c.JSON(404, gin.H{"message": "登录不存在或已注销"})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
+
+// LogoutAll POST /api/v1/auth/logout-all  注销当前游客/用户在所有设备上的登录
+func (a *Account) LogoutAll(c *gin.Context) {
+	o, ok := ownerFrom(c)
+	if !ok {
+		c.JSON(401, gin.H{"message": "无访客"})
+		return
+	}
+	now := time.Now()
+	r := a.DB.Model(&models.RefreshToken{}).Scopes(o.scope).
+		Where("revoked_at IS NULL").Update("revoked_at", &now)
+	if r.Error != nil {
+		c.JSON(500, gin.H{"message": r.Error.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"ok": true})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
+)
+
+// Account 注册用户相关接口：注册、登录、退出
+type Account struct {
+	DB  *gorm.DB
+	Cfg *config.Config
+}
+
+func NewAccount(db *gorm.DB, cfg *config.Config) *Account { return &Account{DB: db, Cfg: cfg} }
+
+// POST /api/v1/auth/register、/api/v1/auth/login
+type credentialReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// normalize 统一邮箱大小写并做最基本的格式校验
+func (r *credentialReq) normalize() bool {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	return strings.Contains(r.Email, "@") && len(r.Password) >= 6 && len(r.Password) <= 72
+}
+
+// Register 用邮箱密码注册账号，密码用 bcrypt 哈希后存储
+// 账号会记住当前的游客 ID，并把该游客的历史数据合并进来；返回的 token 同时带 vid 与 uid
+// 建账号与合并在同一个事务里，合并失败不会留下没有数据的账号；邮箱重复由唯一索引拒绝
+func (a *Account) Register(c *gin.Context) {
+	var req credentialReq
+	if err := c.ShouldBindJSON(&req); err != nil || !req.normalize() {
+		c.JSON(400, gin.H{"message": "邮箱格式错误或密码少于 6 位"})
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	vid := c.GetString(CtxVisitorID)
+	if vid == "" {
+		vid = IssueVisitorID()
+	}
+	u := models.User{Email: req.Email, PasswordHash: string(hash), VisitorID: vid}
+	var merged mergeResult
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		var err error
+		merged, err = mergeGuest(tx, vid, u.ID)
+		return err
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(409, gin.H{"message": "邮箱已被注册"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	a.respondMerged(c, vid, &u, merged)
+}
+
+// Login 校验邮箱密码后签发带 uid 的 token
+// 当前设备上的游客数据同样合并到账号下；没有游客身份时沿用注册时的游客 ID
+func (a *Account) Login(c *gin.Context) {
+	var req credentialReq
+	if err := c.ShouldBindJSON(&req); err != nil || !req.normalize() {
+		c.JSON(400, gin.H{"message": "邮箱或密码错误"})
+		return
+	}
+	var u models.User
+	err := a.DB.Where("email=?", req.Email).Take(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) ||
+		(err == nil && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil) {
+		c.JSON(401, gin.H{"message": "邮箱或密码错误"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"message": err.Error()})
+		return
+	}
+	vid := c.GetString(CtxVisitorID)
+	if vid == "" {
+		vid = u.VisitorID
+	}
+	a.mergeAndRespond(c, vid, &u)
+}
+
+// Logout 退出登录：吊销当前 token 家族（以及 body 里附带的 refresh_token 所在家族），
+// 然后签发一对只带 vid 的游客 token，前端替换掉原 token 即可
+func (a *Account) Logout(c *gin.Context) {
+	vid := c.GetString(CtxVisitorID)
+	if vid == "" {
+		c.JSON(401, gin.H{"code": 401, "message": "未授权"})
+		return
+	}
+	if fid := c.GetString(CtxFamilyID); fid != "" {
+		_ = revokeFamily(a.DB, fid)
+	}
+	var req refreshReq
+	if c.ShouldBindJSON(&req) == nil && req.RefreshToken != "" {
+		var rt models.RefreshToken
+		if a.DB.Where("token_hash=?", hashToken(req.RefreshToken)).Take(&rt).Error == nil {
+			_ = revokeFamily(a.DB, rt.FamilyID)
+		}
+	}
+	a.respondTokens(c, vid, 0, nil)
+}
+
+// mergeAndRespond 把当前游客的历史数据合并到账号下，再签发注册用户的 token
+// 当前的游客 token 家族随之吊销，避免旧 token 继续以游客身份访问
+func (a *Account) mergeAndRespond(c *gin.Context, vid string, u *models.User) {
+	merged, err := mergeGuest(a.DB, vid, u.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"message": "合并游客数据失败：" + err.Error()})
+		return
+	}
+	a.respondMerged(c, vid, u, merged)
+}
+
+// respondMerged 吊销当前的游客 token 家族，签发注册用户的 token 并带上合并结果
+func (a *Account) respondMerged(c *gin.Context, vid string, u *models.User, merged mergeResult) {
+	if fid := c.GetString(CtxFamilyID); fid != "" {
+		_ = revokeFamily(a.DB, fid)
+	}
+	a.respondTokens(c, vid, u.ID, gin.H{"user": u, "merged": merged})
+}
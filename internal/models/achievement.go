@@ -1,13 +1,89 @@
 package models
 
+import "time"
+
+// 成就规则类型，Threshold（JSON 中的 requirement）的单位随类型不同
+const (
+	RuleCumulativeTime = "cumulative_time" // 累计专注秒数
+	RuleSessionCount   = "session_count"   // 完成的会话数
+	RuleSessionLength  = "session_length"  // 单次专注的最长秒数
+	RuleStreak         = "streak"          // 最长连续专注天数（每天至少 MinMinutes 分钟）
+	RuleTimeOfDay      = "time_of_day"     // 在 BeforeHour 点之前 / AfterHour 点之后开始的完成会话数（按用户时区）
+	RuleTaskCompletion = "task_completion" // 完成的任务数
+	RuleCountdownRate  = "countdown_rate"  // 倒计时/番茄钟跑满计划时长的百分比（至少 MinCount 次后才计算）
+)
+
+// 分级成就的等级，同一 Group 下的成就是同一枚徽章的不同等级
+const (
+	TierBronze = "bronze"
+	TierSilver = "silver"
+	TierGold   = "gold"
+)
+
+// ValidTier 等级为空（不分级）或是 bronze/silver/gold 之一
+func ValidTier(t string) bool {
+	return t == "" || t == TierBronze || t == TierSilver || t == TierGold
+}
+
+// Achievement 成就定义，保存在 achievements 表里
+// 表为空时从 ACHIEVEMENTS_FILE（JSON/YAML）导入，没有文件时用下面内置的 Achievements
 type Achievement struct {
-	ID          int    `json:"id"`
+	ID          int    `json:"id" gorm:"primaryKey;autoIncrement:false"`
 	Name        string `json:"name"`
 	Content     string `json:"content"`
 	Subtitle    string `json:"subtitle"`
 	Achievement string `json:"achievement"`
 	Threshold   int64  `json:"requirement"`
-	Unlocked    bool   `json:"unlocked"`
+	Kind        string `json:"kind"`                  // 见 Rule* 常量，为空按 cumulative_time
+	BeforeHour  *int   `json:"before_hour,omitempty"` // time_of_day 用
+	AfterHour   *int   `json:"after_hour,omitempty"`  // time_of_day 用
+	MinMinutes  int    `json:"min_minutes,omitempty"` // streak 用，默认 1
+	MinCount    int    `json:"min_count,omitempty"`   // countdown_rate 用
+	SortOrder   int    `json:"sort_order"`
+	Hidden      bool   `json:"hidden"`                                          // 隐藏成就：解锁前不展示名称与文案
+	Group       string `json:"group,omitempty" gorm:"column:badge_group;index"` // 分级成就的徽章标识
+	Tier        string `json:"tier,omitempty"`                                  // bronze、silver、gold
+	Disabled    bool   `json:"disabled"`                                        // 停用后不再展示、不再评估，已解锁的记录保留
+
+	Unlocked   bool       `json:"unlocked" gorm:"-"`
+	UnlockedAt *time.Time `json:"unlocked_at,omitempty" gorm:"-"`
+}
+
+// RuleKind 规则类型，老数据没有 kind 时按累计时长处理
+func (a Achievement) RuleKind() string {
+	if a.Kind == "" {
+		return RuleCumulativeTime
+	}
+	return a.Kind
+}
+
+// AchievementProgress 归属者在每个成就上的当前进度（单位同 Threshold），会话结束时增量更新
+type AchievementProgress struct {
+	OwnerKey      string    `gorm:"primaryKey"` // u:<user_id> 或 v:<visitor_id>
+	AchievementID int       `gorm:"primaryKey"`
+	Value         int64     `json:"value"`
+	Hits          int64     `json:"-"` // countdown_rate 用：跑满计划时长的次数
+	Runs          int64     `json:"-"` // countdown_rate 用：计入完成率的次数
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// AchievementVersion 成就定义的版本：每次通过管理接口修改后保存一份全部定义的快照，回滚即恢复某个快照
+type AchievementVersion struct {
+	ID            uint      `json:"version" gorm:"primaryKey"`
+	Action        string    `json:"action"` // seed、create、update、reorder、disable、rollback
+	AchievementID *int      `json:"achievement_id"`
+	Note          string    `json:"note,omitempty"`
+	Snapshot      string    `json:"-" gorm:"type:text"` // []Achievement 的 JSON
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UserAchievement 已解锁的成就；一经解锁永久保留，之后门槛调整或数据被修改都不撤回
+type UserAchievement struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	OwnerKey      string    `json:"-" gorm:"uniqueIndex:idx_owner_achievement"`
+	AchievementID int       `json:"achievement_id" gorm:"uniqueIndex:idx_owner_achievement"`
+	SessionID     *uint     `json:"session_id"` // 触发解锁的会话，任务完成等非会话触发时为空
+	UnlockedAt    time.Time `json:"unlocked_at"`
 }
 
 var Achievements = []Achievement{
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DailyStat 每个归属者每天的专注汇总（按归属者的时区切日，按 end_at 归属日期）
+// 由会话的结束、取消、修改、删除增量维护；时区变更或历史数据用 cmd/backfill 整体重建
+type DailyStat struct {
+	OwnerKey  string    `json:"-" gorm:"primaryKey"` // u:<user_id> 或 v:<visitor_id>
+	Day       time.Time `json:"day" gorm:"primaryKey;type:date"`
+	Seconds   int64     `json:"seconds"`  // 已完成会话的总秒数
+	Sessions  int64     `json:"sessions"` // 已完成会话数
+	Canceled  int64     `json:"canceled"` // 已取消会话数
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Goal 每日/每周专注目标，进度按归属者时区的当天/本周（周一起）统计
+type Goal struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	VisitorID string         `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID    *uint          `json:"user_id" gorm:"index"`
+	Period    string         `json:"period"` // daily、weekly
+	Metric    string         `json:"metric"` // minutes（专注分钟）、pomodoros（跑满计划时长的番茄钟/倒计时次数）
+	Target    int            `json:"target"`
+	Active    bool           `json:"active"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKey 带 Idempotency-Key 的写请求第一次的响应，窗口期内同一个 key 的重试直接回放
+// StatusCode 为 0 表示第一次请求还在处理中
+type IdempotencyKey struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	OwnerKey     string    `json:"owner_key" gorm:"uniqueIndex:idx_idempotency_owner_key;not null"`
+	Key          string    `json:"key" gorm:"uniqueIndex:idx_idempotency_owner_key;not null"`
+	RequestHash  string    `json:"request_hash"` // method + path + body 的 sha256，用于识别同 key 不同请求
+	StatusCode   int       `json:"status_code"`
+	ContentType  string    `json:"content_type"`
+	ResponseBody []byte    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
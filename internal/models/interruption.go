@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// 中断原因：前三种由用户暂停时选择，后两种由系统写入
+const (
+	InterruptionInternal    = "internal"    // 内部分心（刷手机、走神）
+	InterruptionExternal    = "external"    // 外部打断（有人找、来电话）
+	InterruptionBreak       = "break"       // 主动休息
+	InterruptionUnspecified = "unspecified" // 暂停时没有给出原因
+	InterruptionAuto        = "auto"        // 心跳超时被服务端自动暂停
+)
+
+// Interruption 一次暂停对应的中断记录（番茄工作法里的“中断日志”）
+// SegmentID 是被这次暂停收口的片段，会话详情里可以把中断放到时间线上
+type Interruption struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SessionID uint      `json:"session_id" gorm:"index"`
+	SegmentID uint      `json:"segment_id"`
+	Reason    string    `json:"reason" gorm:"index"`
+	Note      string    `json:"note"`
+	At        time.Time `json:"at"` // 暂停时刻
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidInterruptionReason 用户可以选择的中断原因
+func ValidInterruptionReason(r string) bool {
+	return r == InterruptionInternal || r == InterruptionExternal || r == InterruptionBreak
+}
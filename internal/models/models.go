@@ -10,18 +10,34 @@ import (
 type Session struct {
 	ID             uint    `json:"id" gorm:"primaryKey"`
 	VisitorID      string  `json:"visitor_id" gorm:"type:uuid"`
-	Mode           string  `json:"mode"` // stopwatch、countdown
+	UserID         *uint   `json:"user_id" gorm:"index"` // 已注册用户的数据按 user_id 归属
+	Mode           string  `json:"mode"`                 // stopwatch、countdown、pomodoro（番茄钟的工作阶段）
 	PlannedMinutes *int    `json:"planned_minutes"`
 	TaskName       *string `json:"task_name"`
+	TaskID         *uint   `json:"task_id" gorm:"index"`    // 关联的任务（可选）
+	CycleID        *uint   `json:"cycle_id" gorm:"index"`   // 所属番茄钟（仅 pomodoro 模式）
+	ClientRef      *string `json:"client_ref" gorm:"index"` // 离线同步时客户端生成的会话 ID，用于重复同步去重
 
-	Status      string         `json:"status"` // 用户状态 started、paused、finished、canceled
-	StartAt     time.Time      `json:"start_at" gorm:"autoCreateTime"`
-	EndAt       *time.Time     `json:"end_at"`
-	DurationSec int64          `json:"duration_sec"` // 结束时写入
-	Segments    []Segment      `json:"segments"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at"` // 客户端最后一次心跳（开始时声明 heartbeat 的从 start_at 算起）；为空的会话不参与自动暂停
+	AutoPaused      bool       `json:"auto_paused"`       // 因心跳超时被服务端自动暂停
+
+	Status      string     `json:"status"` // 用户状态 started、paused、finished、canceled
+	StartAt     time.Time  `json:"start_at" gorm:"autoCreateTime"`
+	EndAt       *time.Time `json:"end_at"`
+	DurationSec int64      `json:"duration_sec"` // 结束时写入
+	Segments    []Segment  `json:"segments"`
+	Tags        []Tag      `json:"tags" gorm:"many2many:session_tags"`
+	// Interruptions 只在会话详情里加载
+	Interruptions []Interruption `json:"interruptions,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// SyncedEvent 离线同步已经应用过的客户端事件 ID，重复上传同一批事件时按 ID 跳过
+type SyncedEvent struct {
+	SessionID uint   `gorm:"primaryKey"`
+	EventID   string `gorm:"primaryKey;size:64"`
 }
 
 // Segment 一个专注片段（开始->结束或未结束）
@@ -32,11 +48,24 @@ type Segment struct {
 	EndAt     *time.Time `json:"seg_end_at"`
 }
 
+// 成长事件类型
+const (
+	GrowthFocus   = "focus"    // 专注完成（或修改/删除后的补偿），minutes 计入成长值
+	GrowthGoalMet = "goal_met" // 达成每日/每周目标，ref_id 为目标 ID，period 为周期第一天
+	// 解锁成就，ref_id 为成就 ID
+	GrowthAchievementUnlocked = "achievement_unlocked"
+)
+
 // GrowthEvent 成长事件：当一次会话结束（>=60s）就写一条 minutes，用于前端/宠物系统消费
+// 其它类型的事件（如达成目标）minutes 为 0，不影响成长值
 type GrowthEvent struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	VisitorID string    `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	Type      string    `json:"type" gorm:"default:focus;index"`
 	SessionID uint      `json:"session_id"`
+	RefID     *uint     `json:"ref_id"`
+	Period    string    `json:"period,omitempty"`
 	Minutes   int       `json:"minutes"`
 	Handled   bool      `json:"handled" gorm:"default:false"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
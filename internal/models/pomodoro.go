@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// PomodoroCycle 一整轮番茄钟：工作 -> 短休息 -> 工作 ... 每 LongBreakEvery 轮工作后长休息
+// 工作阶段是一条 mode=pomodoro 的 Session（计入统计与成长事件），休息阶段单独记在 PomodoroBreak
+type PomodoroCycle struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	VisitorID         string    `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID            *uint     `json:"user_id" gorm:"index"`
+	WorkMinutes       int       `json:"work_minutes"`
+	ShortBreakMinutes int       `json:"short_break_minutes"`
+	LongBreakMinutes  int       `json:"long_break_minutes"`
+	LongBreakEvery    int       `json:"long_break_every"` // 每几轮工作后长休息
+	Rounds            int       `json:"rounds"`           // 计划的工作轮数，最后一轮的休息结束后整轮完成
+	Round             int       `json:"round"`            // 当前第几轮（从 1 开始）
+	Phase             string    `json:"phase"`            // work、short_break、long_break
+	Status            string    `json:"status"`           // running、finished、canceled
+	PhaseStartAt      time.Time `json:"phase_start_at"`
+	SessionID         *uint     `json:"session_id"` // 当前工作阶段对应的会话，休息阶段为空
+	WorkSec           int64     `json:"work_sec"`   // 已完成工作阶段的累计秒数
+	BreakSec          int64     `json:"break_sec"`  // 已结束休息阶段的累计秒数
+	TaskName          *string   `json:"task_name"`
+	TaskID            *uint     `json:"task_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// PomodoroBreak 番茄钟的一次休息（不计入专注时长）
+type PomodoroBreak struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CycleID     uint       `json:"cycle_id" gorm:"index"`
+	Round       int        `json:"round"`
+	Kind        string     `json:"kind"` // short_break、long_break
+	StartAt     time.Time  `json:"start_at"`
+	EndAt       *time.Time `json:"end_at"`
+	DurationSec int64      `json:"duration_sec"`
+}
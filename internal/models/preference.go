@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Preference 归属者的个人设置，每个游客/用户最多一条
+// Timezone 为 IANA 时区名（如 Asia/Shanghai），统计里的“今天”“本周”“本月”都按它切分
+type Preference struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	VisitorID string    `json:"-" gorm:"type:uuid;index"`
+	UserID    *uint     `json:"-" gorm:"index"`
+	Timezone  string    `json:"timezone"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
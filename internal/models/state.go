@@ -0,0 +1,26 @@
+package models
+
+// 会话状态
+const (
+	SessionStarted  = "started"  // 计时中
+	SessionPaused   = "paused"   // 已暂停
+	SessionFinished = "finished" // 已完成（终态）
+	SessionCanceled = "canceled" // 已取消（终态）
+)
+
+// SessionTransitions 会话状态机允许的迁移：key 为当前状态，value 为可以迁移到的状态
+// 新建会话直接进入 started；finished、canceled 是终态，不能再迁移
+var SessionTransitions = map[string][]string{
+	SessionStarted: {SessionPaused, SessionFinished, SessionCanceled},
+	SessionPaused:  {SessionStarted, SessionFinished, SessionCanceled},
+}
+
+// CanTransition 判断会话能否从 from 迁移到 to
+func CanTransition(from, to string) bool {
+	for _, s := range SessionTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Tag 会话标签（如 数学、阅读、工作），同一归属者下名称唯一（不区分大小写，部分唯一索引见 config.Init）
+// Category 是可选的大类，用于把多个标签归到一起统计
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	VisitorID string    `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Category  string    `json:"category"`
+	Color     string    `json:"color"` // 前端展示用，如 #FFB74D
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Task 待办任务，专注会话通过 task_id 关联
+// 任务累计专注时长与完成的番茄数由会话的片段数据统计，不在这里冗余存储
+type Task struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	VisitorID          string         `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID             *uint          `json:"user_id" gorm:"index"`
+	Title              string         `json:"title" gorm:"not null"`
+	Notes              string         `json:"notes"`
+	EstimatedPomodoros int            `json:"estimated_pomodoros"`
+	Status             string         `json:"status" gorm:"default:todo"` // todo、doing、done
+	SortOrder          int            `json:"sort_order"`                 // 越小越靠前
+	CompletedAt        *time.Time     `json:"completed_at"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RefreshToken 刷新令牌（只存 sha256 哈希）
+// 每次刷新都会轮换：旧令牌标记 UsedAt，同一家族（FamilyID）下签发新令牌；
+// 已轮换的令牌再次被使用视为泄露，整个家族一起吊销
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	FamilyID  string     `json:"family_id" gorm:"type:uuid;index"`
+	VisitorID string     `json:"visitor_id" gorm:"type:uuid;index"`
+	UserID    *uint      `json:"user_id" gorm:"index"`
+	UserAgent string     `json:"user_agent"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`    // 已轮换
+	RevokedAt *time.Time `json:"revoked_at"` // 已吊销（退出登录 / 检测到重放）
+	CreatedAt time.Time  `json:"created_at"`
+}
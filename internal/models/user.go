@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// User 注册用户（邮箱 + 密码），游客注册后其专注数据按 user_id 归属
+type User struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Email        string    `json:"email" gorm:"uniqueIndex;not null"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	VisitorID    string    `json:"visitor_id" gorm:"type:uuid"` // 注册时所用的游客 ID
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
 	"github.com/joho/godotenv"
@@ -14,6 +16,34 @@ type Config struct {
 	Env       string // 运行环境：dev 或 prod
 	Addr      string // 服务绑定地址，例如 :3001
 	JWTSecret string // JWT 签名密钥（用于游客身份验证）
+	// CookieAuth 是否允许没有 token 的老客户端继续用 tcid cookie 识别身份
+	CookieAuth bool
+	AccessTTL  time.Duration // access token 有效期（短）
+	RefreshTTL time.Duration // refresh token 有效期（长，每次刷新轮换）
+	// SchedulerInterval 后台调度器扫描间隔（倒计时自动结束等）
+	SchedulerInterval time.Duration
+	// StartConflict 开始新会话时已有进行中会话的处理：reject（拒绝）或 close（先收口旧会话）
+	StartConflict string
+	// IdempotencyTTL 带 Idempotency-Key 的请求保存响应、可被重放的时长
+	IdempotencyTTL time.Duration
+	// HeartbeatGrace 计时中的会话超过这么久没有心跳就自动暂停（片段收口在最后一次心跳），0 表示关闭
+	HeartbeatGrace time.Duration
+	// SessionMaxAge 开始超过这么久仍未结束的会话由后台任务收口，0 表示关闭
+	SessionMaxAge time.Duration
+	// SessionReapAction 收口方式：finish（结算到最后一次活跃时刻，不足 1 分钟则取消）或 cancel
+	SessionReapAction string
+	// DefaultTimezone 没有设置时区的归属者按这个时区切分日期（IANA 名称）
+	DefaultTimezone string
+	// StreakMinMinutes 一天至少专注多少分钟才计入连续天数
+	StreakMinMinutes int
+	// StreakFreezeEvery 每连续达标多少天获得一张冻结卡（漏一天自动消耗），0 表示不发冻结卡
+	StreakFreezeEvery int
+	// StreakFreezeMax 冻结卡最多持有几张
+	StreakFreezeMax int
+	// AchievementsFile 成就表为空时从这个 JSON/YAML 文件导入定义，文件不存在时用内置定义
+	AchievementsFile string
+	// AdminToken 管理接口（/api/v1/admin）要求的 X-Admin-Token，为空时管理接口关闭
+	AdminToken string
 	// Postgres 数据库配置
 	PGUser string // 数据库用户名
 	PGPass string // 数据库密码
@@ -28,19 +58,52 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	c := &Config{
-		Env:       get("ENV", "dev"),    // 默认开发环境
-		Addr:      get("ADDR", ":3001"), // 默认监听 3001 端口
-		JWTSecret: get("JWT_SECRET", "dev-guest-secret"),
-		PGUser:    get("PGUSER", "app"),       // PostgreSQL 用户
-		PGPass:    get("PGPASSWORD", "app"),   // PostgreSQL 密码
-		PGDB:      get("PGDATABASE", "appdb"), // 数据库名
-		PGHost:    get("PGHOST", "localhost"), // 数据库服务器地址
-		PGPort:    get("PGPORT", "5432"),      // PostgreSQL 默认端口
+		Env:               get("ENV", "dev"),    // 默认开发环境
+		Addr:              get("ADDR", ":3001"), // 默认监听 3001 端口
+		JWTSecret:         get("JWT_SECRET", "dev-guest-secret"),
+		CookieAuth:        get("COOKIE_AUTH", "true") == "true", // 默认兼容 cookie 模式
+		AccessTTL:         getPositiveDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTTL:        getPositiveDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		SchedulerInterval: getPositiveDuration("SCHEDULER_INTERVAL", 5*time.Second),
+		StartConflict:     get("START_CONFLICT", "reject"),
+		IdempotencyTTL:    getPositiveDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		HeartbeatGrace:    getDuration("HEARTBEAT_GRACE", 2*time.Minute),
+		SessionMaxAge:     getDuration("SESSION_MAX_AGE", 24*time.Hour),
+		SessionReapAction: get("SESSION_REAP_ACTION", "finish"),
+		DefaultTimezone:   get("DEFAULT_TIMEZONE", "Asia/Shanghai"),
+		StreakMinMinutes:  getInt("STREAK_MIN_MINUTES", 1),
+		StreakFreezeEvery: getInt("STREAK_FREEZE_EVERY", 7),
+		StreakFreezeMax:   getInt("STREAK_FREEZE_MAX", 2),
+		AchievementsFile:  get("ACHIEVEMENTS_FILE", "configs/achievements.json"),
+		AdminToken:        get("ADMIN_TOKEN", ""),
+		PGUser:            get("PGUSER", "app"),       // PostgreSQL 用户
+		PGPass:            get("PGPASSWORD", "app"),   // PostgreSQL 密码
+		PGDB:              get("PGDATABASE", "appdb"), // 数据库名
+		PGHost:            get("PGHOST", "localhost"), // 数据库服务器地址
+		PGPort:            get("PGPORT", "5432"),      // PostgreSQL 默认端口
 	}
-	_ = c // 为了提示器别报警
+	if c.StartConflict != "reject" && c.StartConflict != "close" {
+		return nil, fmt.Errorf("START_CONFLICT %q 无效，只能是 reject 或 close", c.StartConflict)
+	}
+	if c.SessionReapAction != "finish" && c.SessionReapAction != "cancel" {
+		return nil, fmt.Errorf("SESSION_REAP_ACTION %q 无效，只能是 finish 或 cancel", c.SessionReapAction)
+	}
+	if _, err := time.LoadLocation(c.DefaultTimezone); err != nil {
+		return nil, fmt.Errorf("DEFAULT_TIMEZONE %q 无效: %w", c.DefaultTimezone, err)
+	}
+	defaultTimezone = c.DefaultTimezone
 	return c, nil
 }
 
+// defaultTimezone 校验过的 DEFAULT_TIMEZONE，只在 Load 里设置一次
+var defaultTimezone = "UTC"
+
+// DefaultTimezone 没有设置时区的归属者使用的时区
+// 会话收口的路径很多（合并账号、调度器、开始时收口旧会话），拿不到 *Config 的地方也要用到
+func DefaultTimezone() string {
+	return defaultTimezone
+}
+
 func (c *Config) DSN() string {
 	// GORM 的 PostgreSQL 驱动 DSN（数据源名称）格式
 	// sslmode=disable 用于开发环境（生产环境应改为 require）
@@ -61,19 +124,149 @@ func get(k, def string) string {
 	return v
 }
 
+// getDuration 读取 time.ParseDuration 格式的配置（如 15m、720h），为空、格式错误或为负数时返回默认值
+// 0 原样返回，HEARTBEAT_GRACE 等用 0 表示关闭
+func getDuration(k string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(get(k, ""))
+	if err != nil || d < 0 {
+		return def
+	}
+	return d
+}
+
+// getPositiveDuration 同 getDuration，但 0 也回退到默认值
+// 调度间隔传给 time.NewTicker，非正数会直接 panic；各种 TTL 为 0 也没有意义
+func getPositiveDuration(k string, def time.Duration) time.Duration {
+	d := getDuration(k, def)
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// getInt 读取整数配置，为空或格式错误时返回默认值
+func getInt(k string, def int) int {
+	n, err := strconv.Atoi(get(k, ""))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
 // Init  初始化 GORM 数据库连接并运行自动迁移
 // AutoMigrate 会自动创建表、添加缺失的列、创建约束和索引
 // 若表已存在，只会添加新字段或修改字段（不会删除字段）
 func Init(cfg *Config) (*gorm.DB, error) {
 	// 使用 PostgreSQL 驱动打开数据库连接
-	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	// TranslateError 把唯一约束冲突等驱动错误翻译成 gorm.ErrDuplicatedKey 等通用错误
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
-	// 自动迁移这三个模型对应的表结构
-	// Session：计时会话；Segment：计时片段；GrowthEvent：成长事件
-	if err := db.AutoMigrate(&models.Session{}, &models.Segment{}, &models.GrowthEvent{}); err != nil {
+	// 自动迁移各模型对应的表结构
+	// Session：计时会话；Segment：计时片段；GrowthEvent：成长事件；User：注册用户；RefreshToken：刷新令牌；PomodoroCycle/PomodoroBreak：番茄钟及其休息；Task：任务；Tag：会话标签；IdempotencyKey：幂等请求的响应；Interruption：暂停的中断记录；Preference：个人设置；DailyStat：每日汇总；Goal：专注目标；Achievement/AchievementProgress/UserAchievement/AchievementVersion：成就定义、进度、解锁记录与定义的历史版本
+	if err := db.AutoMigrate(&models.Session{}, &models.Segment{}, &models.GrowthEvent{},
+		&models.User{}, &models.RefreshToken{}, &models.PomodoroCycle{}, &models.PomodoroBreak{},
+		&models.Task{}, &models.Tag{}, &models.IdempotencyKey{}, &models.Interruption{}, &models.SyncedEvent{},
+		&models.Preference{}, &models.DailyStat{}, &models.Goal{},
+		&models.Achievement{}, &models.AchievementProgress{}, &models.UserAchievement{}, &models.AchievementVersion{}); err != nil {
+		return nil, err
+	}
+	if err := migrateMutableIndex(db); err != nil {
+		return nil, err
+	}
+	if err := migrateGoalIndexes(db); err != nil {
+		return nil, err
+	}
+	if err := migrateTagIndexes(db); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// migrateMutableIndex 创建部分唯一索引：每个游客（未注册）/用户最多只有一条 started/paused 会话
+// 建索引前先把历史遗留的多余进行中会话（每个归属者只保留最近开始的一条）标记为取消，否则索引会建失败
+func migrateMutableIndex(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 被取消的会话不能留下未收口的片段
+		if err := tx.Exec(`CREATE TEMP TABLE mutable_dups ON COMMIT DROP AS
+			SELECT id FROM sessions
+			WHERE status IN ('started','paused') AND deleted_at IS NULL AND id NOT IN (
+				SELECT DISTINCT ON (COALESCE(user_id::text, visitor_id::text)) id FROM sessions
+				WHERE status IN ('started','paused') AND deleted_at IS NULL
+				ORDER BY COALESCE(user_id::text, visitor_id::text), start_at DESC)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE segments SET end_at=now()
+			WHERE end_at IS NULL AND session_id IN (SELECT id FROM mutable_dups)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE sessions SET status='canceled', end_at=now()
+			WHERE id IN (SELECT id FROM mutable_dups)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_sessions_mutable_visitor ON sessions (visitor_id)
+			WHERE user_id IS NULL AND status IN ('started','paused') AND deleted_at IS NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_sessions_mutable_user ON sessions (user_id)
+			WHERE user_id IS NOT NULL AND status IN ('started','paused') AND deleted_at IS NULL`).Error
+	})
+}
+
+// migrateGoalIndexes 目标相关的部分唯一索引：
+// 每个归属者同一周期同一指标只有一个（未删除的）目标；每个目标每个周期只有一条 goal_met 事件
+// 同样先清掉并发写入留下的重复数据（保留最早的一条），再建索引
+func migrateGoalIndexes(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE goals SET deleted_at=now() WHERE deleted_at IS NULL AND id NOT IN (
+				SELECT MIN(id) FROM goals WHERE deleted_at IS NULL
+				GROUP BY COALESCE(user_id::text, visitor_id::text), period, metric)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_goals_visitor ON goals (visitor_id, period, metric)
+			WHERE user_id IS NULL AND deleted_at IS NULL`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_goals_user ON goals (user_id, period, metric)
+			WHERE user_id IS NOT NULL AND deleted_at IS NULL`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM growth_events WHERE type='goal_met' AND id NOT IN (
+				SELECT MIN(id) FROM growth_events WHERE type='goal_met' GROUP BY ref_id, period)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_growth_goal_met ON growth_events (ref_id, period)
+			WHERE type='goal_met'`).Error
+	})
+}
+
+// migrateTagIndexes 同一归属者下标签名（不区分大小写）唯一
+// 已有的重复标签并到最早的那个上：会话关联改指过去，再删掉多余的标签
+func migrateTagIndexes(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE TEMP TABLE tag_dups ON COMMIT DROP AS
+			SELECT id, keep FROM (
+				SELECT id, MIN(id) OVER (PARTITION BY COALESCE(user_id::text, visitor_id::text), lower(name)) AS keep FROM tags
+			) t WHERE id<>keep`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`INSERT INTO session_tags (session_id, tag_id)
+			SELECT st.session_id, d.keep FROM session_tags st JOIN tag_dups d ON st.tag_id=d.id
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM session_tags WHERE tag_id IN (SELECT id FROM tag_dups)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM tags WHERE id IN (SELECT id FROM tag_dups)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_tags_visitor ON tags (visitor_id, lower(name))
+			WHERE user_id IS NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_tags_user ON tags (user_id, lower(name))
+			WHERE user_id IS NOT NULL`).Error
+	})
+}
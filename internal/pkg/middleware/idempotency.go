@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/handlers"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/models"
+)
+
+// captureWriter 在写给客户端的同时把响应体留一份，用于保存幂等响应
+type captureWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 中间件：支持 Idempotency-Key 请求头（移动端在弱网下会自动重试 POST）
+// 同一归属者的同一个 key 在 ttl 内只执行一次：第一次的响应被保存，之后的重试直接回放（响应头 Idempotent-Replayed: true）
+// 同一个 key 配上不同的请求体返回 422；第一次请求还在处理中时返回 409
+// 5xx 响应不保存，客户端可以用同一个 key 重试；没有带该请求头的请求不受影响
+func Idempotency(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		owner := handlers.OwnerKey(c)
+		if owner == "" || len(key) > 128 {
+			c.AbortWithStatusJSON(400, gin.H{"message": "无效的Idempotency-Key"})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, gin.H{"message": "读取请求体失败"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.FullPath()+"\n"), body...))
+		hash := hex.EncodeToString(sum[:])
+
+		rec, fresh, err := claimKey(db, owner, key, hash, ttl)
+		if err != nil {
+			c.AbortWithStatusJSON(500, gin.H{"message": err.Error()})
+			return
+		}
+		if !fresh {
+			switch {
+			case rec.RequestHash != hash:
+				c.AbortWithStatusJSON(422, gin.H{"message": "Idempotency-Key 已用于不同的请求"})
+			case rec.StatusCode == 0:
+				c.AbortWithStatusJSON(409, gin.H{"message": "相同的请求正在处理中"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(rec.StatusCode, rec.ContentType, rec.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		// 处理过程中 panic 时释放占用，避免这个 key 在窗口期内一直“处理中”
+		defer func() {
+			if r := recover(); r != nil {
+				db.Delete(&rec)
+				panic(r)
+			}
+		}()
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if c.Writer.Status() >= 500 {
+			db.Delete(&rec)
+			return
+		}
+		db.Model(&rec).Updates(map[string]any{
+			"status_code":   c.Writer.Status(),
+			"content_type":  c.Writer.Header().Get("Content-Type"),
+			"response_body": w.buf.Bytes(),
+		})
+	}
+}
+
+// claimKey 尝试占用 (owner, key)：插入成功返回 fresh=true；已存在则返回已有记录
+// 已过期的记录视为不存在，删除后重新占用
+func claimKey(db *gorm.DB, owner, key, hash string, ttl time.Duration) (models.IdempotencyKey, bool, error) {
+	for range 2 {
+		rec := models.IdempotencyKey{
+			OwnerKey:    owner,
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		r := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+		if r.Error != nil {
+			return rec, false, r.Error
+		}
+		if r.RowsAffected == 1 {
+			return rec, true, nil
+		}
+		var old models.IdempotencyKey
+		err := db.Where("owner_key=? AND key=?", owner, key).Take(&old).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // 刚好被清理掉了，再占一次
+		}
+		if err != nil {
+			return old, false, err
+		}
+		if time.Now().Before(old.ExpiresAt) {
+			return old, false, nil
+		}
+		if err := db.Delete(&old).Error; err != nil {
+			return old, false, err
+		}
+	}
+	return models.IdempotencyKey{}, false, errors.New("Idempotency-Key 冲突，请重试")
+}
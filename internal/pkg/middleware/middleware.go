@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"crypto/subtle"
+	"strings"
+
 	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/handlers"
+	"github.com/NCUHOME-Y/25-Hack-TimiCat-BE/internal/pkg/config"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Visitor  中间件：为每个游客分配唯一 ID（存储在 cookie 中）
@@ -19,3 +24,78 @@ func Visitor() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Auth  中间件：识别请求者身份并写入 gin.Context（key 为 handlers.CtxVisitorID / CtxUserID）
+// 优先读取 Authorization: Bearer <token>，校验签名、过期时间以及所属 token 家族是否已被吊销；
+// token 无效直接返回 401
+// 没有携带 token 时，若开启了 cookie 兼容模式（老客户端），退回读取 tcid cookie
+func Auth(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if msg := identify(c, cfg, db); msg != "" {
+			c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": msg})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuth  中间件：注册/登录用，只尽量识别当前游客以便合并数据
+// token 过期、被吊销或格式错误时不拦截，按没有游客身份处理
+func OptionalAuth(cfg *config.Config, db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 校验失败时 identify 不会写入任何身份
+		_ = identify(c, cfg, db)
+		c.Next()
+	}
+}
+
+// identify 解析 token（或兼容模式下的 tcid cookie）并写入身份，token 无效时返回原因
+func identify(c *gin.Context, cfg *config.Config, db *gorm.DB) string {
+	if h := c.GetHeader("Authorization"); h != "" {
+		token, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return "Authorization 格式错误"
+		}
+		claims, err := handlers.ParseToken(cfg.JWTSecret, strings.TrimSpace(token))
+		if err != nil {
+			return "token无效或已过期"
+		}
+		// 旧版 token 没有 fid，只校验过期时间
+		if fid, _ := claims["fid"].(string); fid != "" {
+			if !handlers.FamilyActive(db, fid) {
+				return "登录已注销"
+			}
+			c.Set(handlers.CtxFamilyID, fid)
+		}
+		vid, _ := claims["vid"].(string)
+		c.Set(handlers.CtxVisitorID, vid)
+		// JSON 数字解出来是 float64；只有注册用户的 token 才带 uid
+		if uid, ok := claims["uid"].(float64); ok && uid > 0 {
+			c.Set(handlers.CtxUserID, uint(uid))
+		}
+		return ""
+	}
+	if cfg.CookieAuth {
+		if vid, err := c.Cookie("tcid"); err == nil && vid != "" {
+			c.Set(handlers.CtxVisitorID, vid)
+		}
+	}
+	return ""
+}
+
+// Admin  中间件：管理接口鉴权，请求头 X-Admin-Token 必须与 ADMIN_TOKEN 一致
+// 没有配置 ADMIN_TOKEN 时管理接口整体关闭，返回 404
+func Admin(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.AdminToken == "" {
+			c.AbortWithStatusJSON(404, gin.H{"code": 404, "message": "管理接口未开启"})
+			return
+		}
+		token := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			c.AbortWithStatusJSON(401, gin.H{"code": 401, "message": "管理口令错误"})
+			return
+		}
+		c.Next()
+	}
+}